@@ -2,8 +2,11 @@ package main
 
 import (
 	"flag"
+	"io"
 	"kondocontrol/internal/eeprom"
 	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/kinematics"
+	kondorobot "kondocontrol/internal/robot"
 	"log"
 	"math"
 	"net/http"
@@ -17,17 +20,46 @@ import (
 	"github.com/jacobsa/go-serial/serial"
 )
 
-var robot khr_3hv.RobotNum
+var (
+	robot       khr_3hv.RobotNum
+	model       *kinematics.Model
+	calibration kinematics.Calibration
+	// poseChecks run before every pose the API sends
+	poseChecks []khr_3hv.PoseCheck
+	// monitor watches the current and temperature of the joints, nil when disabled
+	monitor *khr_3hv.Monitor
+)
 
 func main() {
 	var (
-		lp = flag.String("left-port", "", "left port")
-		rp = flag.String("right-port", "", "right port")
+		lp   = flag.String("left-port", "", "left port")
+		rp   = flag.String("right-port", "", "right port")
+		desc = flag.String("robot", "", "robot description file, the stock KHR-3HV when empty")
+		mdl  = flag.String("model", "", "kinematic model file, the stock KHR-3HV when empty")
+		mode = flag.String("limit-mode", "", "clamp or reject position commands outside the joint limits, as described when empty")
+		coll = flag.Bool("collisions", false, "reject poses where links of the model intersect")
+		mon  = flag.Bool("monitor", false, "poll current and temperature, lower the stretch of or free joints that get too hot")
 	)
 	flag.Parse()
 	if *lp == "" || *rp == "" {
 		log.Fatalf("left and right port should not be empty, (lp: %s,rp: %s)", *lp, *rp)
 	}
+	var err error
+	description := khr_3hv.DefaultDescription()
+	if *desc != "" {
+		if description, err = kondorobot.LoadFile(*desc); err != nil {
+			log.Fatal(err)
+		}
+	}
+	model = kinematics.DefaultModel()
+	if *mdl != "" {
+		if model, err = kinematics.LoadModelFile(*mdl); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if calibration, err = kinematics.NewCalibration(description); err != nil {
+		log.Fatal(err)
+	}
 	// Set up leftOptions.
 	leftOptions := serial.OpenOptions{
 		PortName:          *lp,
@@ -55,10 +87,39 @@ func main() {
 	defer leftPort.Close()
 
 	// init robot
-	robot, err = khr_3hv.DefaultRobotNum(leftPort, rightPort)
+	robot, err = khr_3hv.NewRobotNum(description, map[string]io.ReadWriteCloser{
+		"left":  leftPort,
+		"right": rightPort,
+	})
 	if err != nil {
 		log.Fatal(err)
 	}
+	if *mode != "" {
+		if err := robot.SetLimitMode(*mode); err != nil {
+			log.Fatal(err)
+		}
+	}
+	robot.OnLimitViolation(func(kind khr_3hv.Kind, v khr_3hv.LimitViolation) {
+		log.Printf("limit: %s", v.Error())
+	})
+	if err := robot.LoadLimits(); err != nil {
+		log.Printf("EEPROM pulse limits are not used: %v", err)
+	}
+	calibration = calibration.WithLimits(&robot)
+	if *coll {
+		poseChecks = append(poseChecks, model.CollisionCheck(calibration, &robot))
+	}
+	if *mon {
+		monitor = robot.Monitor(khr_3hv.DefaultMonitorConfig())
+		defer monitor.Stop()
+		poseChecks = append(poseChecks, monitor.Check())
+		events, _ := monitor.Subscribe()
+		go func() {
+			for e := range events {
+				log.Printf("monitor: %s %s, temperature %d current %d %s", e.Joint, e.Level, e.Sample.Temperature, e.Sample.Current, e.Error)
+			}
+		}()
+	}
 
 	// run api
 	apiRouter().Run(":8080")
@@ -79,6 +140,24 @@ func apiRouter() *gin.Engine {
 	api.GET("/wscontrol", wscontrol)
 	api.GET("/batch_wscontrol", batchWscontrol)
 	api.GET("/control", control)
+	api.GET("/joints", joints)
+	api.GET("/limits", limits)
+	api.POST("/pose", applyPose)
+	api.GET("/kinematics", forwardKinematics)
+	api.POST("/kinematics", forwardKinematics)
+	api.POST("/kinematics/leg", legIK)
+	api.GET("/kinematics/stability", stability)
+	api.POST("/kinematics/stability", stability)
+	api.GET("/kinematics/collisions", collisions)
+	api.POST("/kinematics/collisions", collisions)
+	api.GET("/monitor", monitorStatus)
+	api.GET("/monitor/events", monitorEvents)
+	api.GET("/monitor/ws", monitorWebsocket)
+	api.POST("/monitor/reset", monitorReset)
+	api.GET("/eeprom/fields", eepromFields)
+	api.GET("/eeprom/inspect", inspectEEPROM)
+	api.GET("/eeprom", getEEPROM)
+	api.POST("/eeprom", setEEPROM)
 
 	return api
 }
@@ -100,7 +179,7 @@ func batchWscontrol(c *gin.Context) {
 			return
 		}
 		if msgType == websocket.TextMessage {
-			// <number>,<angle>,<number>,<angle>,...
+			// <number or name>,<angle>,<number>,<angle>,...
 			cmd := strings.Split(string(msg), ",")
 			if len(cmd)%2 != 0 || len(cmd) == 0 {
 				log.Printf("不正確輸入: len(cmd) = %d\n%s\n", len(cmd), cmd)
@@ -132,7 +211,7 @@ func wscontrol(c *gin.Context) {
 			return
 		}
 		if msgType == websocket.TextMessage {
-			// <number>,<angle>
+			// <number or name>,<angle>
 			cmd := strings.SplitN(string(msg), ",", 2)
 			if err := stringToPosition(cmd[0], cmd[1]); err != nil {
 				log.Println(err)
@@ -151,11 +230,307 @@ func control(c *gin.Context) {
 	}
 }
 
+// joints lists the number and name of every joint, either can be used as number
+func joints(c *gin.Context) {
+	list := make([]gin.H, 0, len(robot))
+	for _, kind := range robot.Kinds() {
+		list = append(list, gin.H{"number": uint8(kind), "name": kind.String(), "id": robot[kind].GetID()})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// limits lists the soft limits every position command is checked against
+func limits(c *gin.Context) {
+	list := make([]gin.H, 0, len(robot))
+	for _, kind := range robot.Kinds() {
+		min, max := robot[kind].Limits()
+		mode := robot[kind].Joint.Limits.Mode
+		if mode == "" {
+			mode = kondorobot.Reject
+		}
+		list = append(list, gin.H{"number": uint8(kind), "name": kind.String(), "min": min, "max": max, "mode": mode})
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// applyPose sends a pose to every joint in it and returns the positions read back
+// body: {"name": "<name>", "positions": {"<joint name or number>": <position>, ...}}
+func applyPose(c *gin.Context) {
+	var p khr_3hv.Pose
+	if err := c.ShouldBindJSON(&p); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	readback, err := robot.ApplyPose(p, poseChecks...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "readback": readback})
+		return
+	}
+	c.JSON(http.StatusOK, readback)
+}
+
+// forwardKinematics returns the frame of every effector, or of every link with
+// links=true, for the pose in the body of a POST or the last positions of the robot
+func forwardKinematics(c *gin.Context) {
+	p, ok := requestPose(c)
+	if !ok {
+		return
+	}
+	if c.Query("links") == "true" {
+		c.JSON(http.StatusOK, model.ForwardPose(calibration, p))
+		return
+	}
+	c.JSON(http.StatusOK, model.EffectorFrames(calibration.Angles(p)))
+}
+
+// stability returns the center of mass and support polygon of the pose in the body
+// of a POST or the last positions of the robot
+func stability(c *gin.Context) {
+	p, ok := requestPose(c)
+	if !ok {
+		return
+	}
+	s, err := model.Stability(calibration.Angles(p))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, s)
+}
+
+// collisions lists the intersecting links of the pose in the body of a POST or the last
+// positions of the robot, joints missing in a POST are taken from the robot
+func collisions(c *gin.Context) {
+	p, ok := requestPose(c)
+	if !ok {
+		return
+	}
+	full := robot.Current(khr_3hv.Kinds())
+	for kind, position := range p.Positions {
+		full.Positions[kind] = position
+	}
+	list := model.Collisions(calibration.Angles(full))
+	if list == nil {
+		list = []kinematics.Collision{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// requestPose is the pose in the body of a POST or the last positions of the robot
+func requestPose(c *gin.Context) (khr_3hv.Pose, bool) {
+	p := khr_3hv.Pose{Positions: map[khr_3hv.Kind]uint{}}
+	if c.Request.Method == http.MethodPost {
+		if err := c.ShouldBindJSON(&p); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return p, false
+		}
+		return p, true
+	}
+	for _, kind := range khr_3hv.Kinds() {
+		if position := robot[kind].Position; position != 0 {
+			p.Positions[kind] = position
+		}
+	}
+	return p, true
+}
+
+// legIK solves the joints of a leg for a foot target in the hip frame, apply=true sends them
+// /kinematics/leg?side=<Left|Right>&apply=<true|false>
+// body: {"position": [x, y, z], "roll": <rad>, "pitch": <rad>, "yaw": <rad>}
+func legIK(c *gin.Context) {
+	var target struct {
+		Position kinematics.Vec3 `json:"position"`
+		Roll     float64         `json:"roll"`
+		Pitch    float64         `json:"pitch"`
+		Yaw      float64         `json:"yaw"`
+	}
+	if err := c.ShouldBindJSON(&target); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	side := kinematics.Side(c.Query("side"))
+	if side != kinematics.Left && side != kinematics.Right {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "side should be Left or Right"})
+		return
+	}
+	p, err := model.LegIK(calibration, side, kinematics.Transform{R: kinematics.RPY(target.Roll, target.Pitch, target.Yaw), P: target.Position})
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+	if c.Query("apply") == "true" {
+		if p, err = robot.ApplyPose(p, poseChecks...); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusOK, p)
+}
+
+// monitorStatus is the last current and temperature of every joint, with its level and trend
+func monitorStatus(c *gin.Context) {
+	if monitor == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "monitor is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, monitor.Status())
+}
+
+// monitorEvents are the last monitor events, oldest first
+func monitorEvents(c *gin.Context) {
+	if monitor == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "monitor is disabled"})
+		return
+	}
+	c.JSON(http.StatusOK, monitor.Events())
+}
+
+// monitorWebsocket sends every monitor event as JSON as it happens
+func monitorWebsocket(c *gin.Context) {
+	if monitor == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "monitor is disabled"})
+		return
+	}
+	var upgrader = websocket.Upgrader{} // use default options
+	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Println("upgrade:", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "wesocket upgrade failed"})
+		return
+	}
+	defer ws.Close()
+	events, cancel := monitor.Subscribe()
+	defer cancel()
+	// reading notices the client going away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := ws.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		select {
+		case <-closed:
+			return
+		case e := <-events:
+			if err := ws.WriteJSON(e); err != nil {
+				log.Println(err)
+				return
+			}
+		}
+	}
+}
+
+// monitorReset lets a cooled down joint move again, with its stretch back
+// /monitor/reset?joint=<number or name>
+func monitorReset(c *gin.Context) {
+	if monitor == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "monitor is disabled"})
+		return
+	}
+	kind, err := khr_3hv.ParseKind(c.Query("joint"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := monitor.Reset(kind); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"joint": kind.String(), "level": khr_3hv.MonitorNormal})
+}
+
+// eepromFields lists the EEPROM fields that can be read or changed by name
+func eepromFields(c *gin.Context) {
+	c.JSON(http.StatusOK, eeprom.Fields())
+}
+
+// inspectEEPROM annotates the EEPROM image of a joint
+// /eeprom/inspect?number=<number or name>&format=<text|markdown|json>
+func inspectEEPROM(c *gin.Context) {
+	num, err := khr_3hv.ParseKind(c.Query("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	inspection, err := robot[num].InspectEEPROM()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	switch format := eeprom.Format(c.DefaultQuery("format", string(eeprom.JSON))); format {
+	case eeprom.Text:
+		c.Header("Content-Type", "text/plain; charset=utf-8")
+		inspection.Render(c.Writer, format)
+	case eeprom.Markdown:
+		c.Header("Content-Type", "text/markdown; charset=utf-8")
+		inspection.Render(c.Writer, format)
+	default:
+		c.JSON(http.StatusOK, inspection)
+	}
+}
+
+// getEEPROM reads the field of a joint, every field when field is empty
+// /eeprom?number=<number or name>&field=<field>
+func getEEPROM(c *gin.Context) {
+	num, err := khr_3hv.ParseKind(c.Query("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := robot[num].ReadEEPROM(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	names := c.QueryArray("field")
+	if len(names) == 0 {
+		for _, f := range eeprom.Fields() {
+			names = append(names, f.Name)
+		}
+	}
+	values := gin.H{}
+	for _, name := range names {
+		value, err := robot[num].EEPROM.Get(name)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		values[name] = value
+	}
+	c.JSON(http.StatusOK, values)
+}
+
+// setEEPROM changes fields of a joint and verifies the write
+// /eeprom?number=<number or name>&set=<field>=<value>&set=...
+func setEEPROM(c *gin.Context) {
+	num, err := khr_3hv.ParseKind(c.Query("number"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result, err := robot[num].UpdateEEPROM(func(e *eeprom.EEPROM) error {
+		for _, assignment := range c.QueryArray("set") {
+			if err := e.Apply(assignment); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "changes": result.Changes, "rolled-back": result.RolledBack})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"changes": result.Changes})
+}
+
 var lastAngle [22]uint
 
 func stringToPosition(number, angle string) error {
 
-	num, err := strconv.Atoi(number)
+	num, err := khr_3hv.ParseKind(number)
 	if err != nil {
 		return errors.Wrap(err, "number")
 	}
@@ -163,16 +538,15 @@ func stringToPosition(number, angle string) error {
 	if err != nil {
 		return errors.Wrap(err, "angle")
 	}
-	if num > khr_3hv.LimitNum() {
-		return errors.New("cmd[0] is bigger than LimitNum")
-	}
-	if uint16(ang) > eeprom.MaximumPosition || uint16(ang) < eeprom.MinimumPosition {
-		return errors.New("angle is bigger than eeprom.MaximumPosition or smaller than eeprom.MinimumPosition")
-	}
 	if math.Abs(float64(lastAngle[num]-uint(ang))) < 50 {
 		return nil
 	}
-	robot[num].SetPosition(uint(ang))
+	// a one-joint pose goes through poseChecks like any other, the collision
+	// check takes the other joints from their current positions
+	pose := khr_3hv.Pose{Name: "slider", Positions: map[khr_3hv.Kind]uint{num: uint(ang)}}
+	if _, err := robot.ApplyPose(pose, poseChecks...); err != nil {
+		return err
+	}
 	lastAngle[num] = uint(ang)
 	log.Printf("number: %s, angle: %s", number, angle)
 	return nil
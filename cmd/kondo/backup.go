@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"os"
+)
+
+func backup(args []string) error {
+	var (
+		fs    = flag.NewFlagSet("backup", flag.ExitOnError)
+		robot = newRobotFlags(fs)
+		dir   = fs.String("dir", "backup", "directory the timestamped backup is created in")
+	)
+	fs.Parse(args)
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	b, err := r.Backup(*dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range b.Entries {
+		fmt.Printf("joint %2d, id %2d: %s %s\n", entry.Kind, entry.ID, entry.File, entry.SHA256)
+	}
+	fmt.Println("backup saved to", b.Dir)
+	return nil
+}
+
+func restore(args []string) error {
+	var (
+		fs     = flag.NewFlagSet("restore", flag.ExitOnError)
+		robot  = newRobotFlags(fs)
+		dir    = fs.String("dir", "", "backup directory to restore from")
+		joints = fs.String("joints", "", "comma separated joint numbers or names to restore, empty is the whole robot")
+		yes    = fs.Bool("yes", false, "write without asking after the preview")
+	)
+	fs.Parse(args)
+	if *dir == "" {
+		return fmt.Errorf("-dir should not be empty")
+	}
+	kinds, err := parseKinds(*joints)
+	if err != nil {
+		return err
+	}
+	b, err := khr_3hv.OpenBackup(*dir)
+	if err != nil {
+		return err
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	plans, err := r.PreviewRestore(b, kinds)
+	if err != nil {
+		return err
+	}
+	changed := 0
+	for _, plan := range plans {
+		if !plan.Pending() {
+			continue
+		}
+		changed++
+		fmt.Printf("*** joint %d, id %d ***\n", plan.Kind, plan.ID)
+		for _, c := range plan.Changes {
+			fmt.Println("  ", c)
+		}
+		if len(plan.Changes) == 0 {
+			fmt.Println("   reserved bytes only")
+		}
+	}
+	if changed == 0 {
+		fmt.Println("servos already match the backup")
+		return nil
+	}
+	if !*yes && !confirm(os.Stdout, fmt.Sprintf("restore %d joints from %s?", changed, b.Dir)) {
+		return nil
+	}
+	if err := r.Restore(plans); err != nil {
+		return err
+	}
+	fmt.Println("restored and verified")
+	return nil
+}
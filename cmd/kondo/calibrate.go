@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/khr_3hv"
+	"os"
+	"strings"
+)
+
+func calibrate(args []string) error {
+	var (
+		fs     = flag.NewFlagSet("calibrate", flag.ExitOnError)
+		robot  = newRobotFlags(fs)
+		joints = fs.String("joints", "", "comma separated joint numbers or names, every joint when empty")
+		group  = fs.String("group", "", "joint group to calibrate ("+strings.Join(khr_3hv.GroupNames(), ", ")+")")
+		target = fs.String("target", khr_3hv.CalibrateConfig, "store offsets in the robot description (config) or the servo EEPROM UserOffset (eeprom)")
+		out    = fs.String("out", "", "file to save the robot description with the new zero offsets")
+		yes    = fs.Bool("yes", false, "store without asking after the report")
+	)
+	fs.Parse(args)
+	if *target != khr_3hv.CalibrateConfig && *target != khr_3hv.CalibrateEEPROM {
+		return fmt.Errorf("target should be %s or %s", khr_3hv.CalibrateConfig, khr_3hv.CalibrateEEPROM)
+	}
+	if *out == "" {
+		return fmt.Errorf("-out should be given, the zero offsets are saved in a robot description")
+	}
+	kinds, err := parseKinds(*joints)
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 && *group != "" {
+		if kinds, err = khr_3hv.Group(*group); err != nil {
+			return err
+		}
+	}
+	desc, err := loadDescription(*robot.desc)
+	if err != nil {
+		return err
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+	if len(kinds) == 0 {
+		kinds = r.Kinds()
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	results, err := r.CalibrateZero(kinds, func(kind khr_3hv.Kind) error {
+		fmt.Printf("%s is free, put it straight on the jig and press enter (q to stop) ", kind)
+		answer, err := in.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(answer) == "q" {
+			return errors.New("stopped by the operator")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("*** report ***")
+	var ok int
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Printf("%-18s id %2d: FAIL %v\n", result.Kind, result.ID, result.Err)
+			continue
+		}
+		ok++
+		fmt.Printf("%-18s id %2d: straight at %5d, offset %+4d\n", result.Kind, result.ID, result.Position, result.Offset)
+	}
+	if ok == 0 {
+		return fmt.Errorf("no joint was calibrated")
+	}
+	if !*yes && !confirm(os.Stdout, fmt.Sprintf("store %d offsets in the %s?", ok, *target)) {
+		return nil
+	}
+	storeErr := r.StoreZeroOffsets(results, *target)
+	for _, result := range results {
+		if result.Err == nil {
+			fmt.Printf("%-18s id %2d: %+4d -> %+4d\n", result.Kind, result.ID, result.Previous, result.Stored)
+		}
+	}
+	if err := r.CopyZeroOffsets(desc); err != nil {
+		return err
+	}
+	data, err := desc.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(*out, data, 0644); err != nil {
+		return err
+	}
+	fmt.Println("robot description saved to", *out)
+	return storeErr
+}
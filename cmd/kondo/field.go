@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kondocontrol/internal/eeprom"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+func fields(args []string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tRANGE\tUNIT")
+	for _, f := range eeprom.Fields() {
+		var valueRange string
+		switch {
+		case len(f.Values) > 0:
+			valueRange = strings.Join(f.Values, ", ")
+		case f.Type == "bool":
+			valueRange = "true, false"
+		case f.Step > 1:
+			valueRange = fmt.Sprintf("%d-%d, step %d", f.Min, f.Max, f.Step)
+		default:
+			valueRange = fmt.Sprintf("%d-%d", f.Min, f.Max)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, f.Type, valueRange, f.Unit)
+	}
+	return w.Flush()
+}
+
+func get(args []string) error {
+	var (
+		fs    = flag.NewFlagSet("get", flag.ExitOnError)
+		robot = newRobotFlags(fs)
+		joint = fs.String("joint", "", "joint number or name")
+	)
+	fs.Parse(args)
+	kind, err := parseJoint(*joint)
+	if err != nil {
+		return err
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		for _, f := range eeprom.Fields() {
+			names = append(names, f.Name)
+		}
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	m := &r[kind]
+	if _, err := m.ReadEEPROM(); err != nil {
+		return err
+	}
+	for _, name := range names {
+		value, err := m.EEPROM.Get(name)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s=%s\n", name, value)
+	}
+	return nil
+}
+
+func set(args []string) error {
+	var (
+		fs    = flag.NewFlagSet("set", flag.ExitOnError)
+		robot = newRobotFlags(fs)
+		joint = fs.String("joint", "", "joint number or name")
+	)
+	fs.Parse(args)
+	kind, err := parseJoint(*joint)
+	if err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return fmt.Errorf("nothing to set, use <field>=<value>")
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	result, err := r[kind].UpdateEEPROM(func(e *eeprom.EEPROM) error {
+		for _, assignment := range fs.Args() {
+			if err := e.Apply(assignment); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, c := range result.Changes {
+		fmt.Println(c)
+	}
+	if err != nil {
+		return err
+	}
+	if len(result.Changes) == 0 {
+		fmt.Println("nothing changed")
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/eeprom"
+	"os"
+)
+
+func inspect(args []string) error {
+	var (
+		fs     = flag.NewFlagSet("inspect", flag.ExitOnError)
+		robot  = newRobotFlags(fs)
+		joint  = fs.String("joint", "", "joint number or name to read the EEPROM from")
+		file   = fs.String("file", "", "raw 64 byte EEPROM image to inspect instead of a joint")
+		format = fs.String("format", string(eeprom.Text), "text, markdown or json")
+	)
+	fs.Parse(args)
+	var (
+		inspection eeprom.Inspection
+		err        error
+	)
+	if *file != "" {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		if inspection, err = eeprom.Inspect(data); err != nil {
+			return err
+		}
+	} else {
+		kind, err := parseJoint(*joint)
+		if err != nil {
+			return err
+		}
+		r, closePorts, err := robot.open()
+		if err != nil {
+			return err
+		}
+		defer closePorts()
+		if inspection, err = r[kind].InspectEEPROM(); err != nil {
+			return err
+		}
+	}
+	if err = inspection.Render(os.Stdout, eeprom.Format(*format)); err != nil {
+		return err
+	}
+	if !inspection.Valid {
+		return fmt.Errorf("EEPROM is not valid")
+	}
+	return nil
+}
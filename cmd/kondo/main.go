@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/kinematics"
+	"kondocontrol/internal/robot"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jacobsa/go-serial/serial"
+)
+
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"backup":       {"backup every servo EEPROM into a timestamped directory", backup},
+	"restore":      {"restore servo EEPROM from a backup directory", restore},
+	"fields":       {"list the EEPROM fields that can be read or changed by name", fields},
+	"get":          {"read EEPROM fields of a joint by name", get},
+	"set":          {"change EEPROM fields of a joint, like Punch=4 Flag.Reverse=true", set},
+	"preset":       {"preview and apply a tuning preset to a group of joints", preset},
+	"inspect":      {"show an EEPROM image as an annotated table", inspect},
+	"play":         {"play a motion file", play},
+	"record":       {"record joints moved by hand into a motion file", record},
+	"check-motion": {"validate motion files, -stability and -collisions check they are safe to play", checkMotion},
+	"walk":         {"generate a walk with leg IK and play it or save it as a motion file", walk},
+	"mirror":       {"mirror a motion file across the sagittal plane, left becomes right", mirror},
+	"import-csv":   {"convert a CSV table of joint positions into a motion file", importCSV},
+	"selftest":     {"check every servo answers and matches the robot description, with a pass/fail report", selfTest},
+	"calibrate":    {"align every joint to a jig and store its zero offset in the config or EEPROM", calibrate},
+	"urdf":         {"export the kinematic model as URDF, limited by the joint and EEPROM pulse limits", urdf},
+	"import-urdf":  {"take link lengths and joint limits from a URDF into a model and robot description", importURDF},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		usage()
+	}
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatalf("%s: %+v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s <command> [flags]\n\n", os.Args[0])
+	for name, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", name, cmd.usage)
+	}
+	os.Exit(2)
+}
+
+// robotFlags are the flags shared by every command that talks to the robot
+type robotFlags struct {
+	lp   *string
+	rp   *string
+	desc *string
+}
+
+func newRobotFlags(fs *flag.FlagSet) robotFlags {
+	return robotFlags{
+		lp:   fs.String("left-port", "", "left port"),
+		rp:   fs.String("right-port", "", "right port"),
+		desc: fs.String("robot", "", "robot description file, the stock KHR-3HV when empty"),
+	}
+}
+
+// loadDescription loads a robot description file, the stock KHR-3HV when path is empty
+func loadDescription(path string) (*robot.Robot, error) {
+	if path == "" {
+		return khr_3hv.DefaultDescription(), nil
+	}
+	return robot.LoadFile(path)
+}
+
+// loadKinematics loads a kinematic model and calibrates it with a robot description,
+// the stock KHR-3HV for an empty path
+func loadKinematics(modelPath, descPath string) (*kinematics.Model, kinematics.Calibration, error) {
+	desc, err := loadDescription(descPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	model := kinematics.DefaultModel()
+	if modelPath != "" {
+		if model, err = kinematics.LoadModelFile(modelPath); err != nil {
+			return nil, nil, err
+		}
+	}
+	c, err := kinematics.NewCalibration(desc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return model, c, nil
+}
+
+// open opens both ports and builds the described robot on them
+func (f robotFlags) open() (khr_3hv.RobotNum, func(), error) {
+	if *f.lp == "" || *f.rp == "" {
+		return khr_3hv.RobotNum{}, nil, fmt.Errorf("left and right port should not be empty, (lp: %s,rp: %s)", *f.lp, *f.rp)
+	}
+	desc, err := loadDescription(*f.desc)
+	if err != nil {
+		return khr_3hv.RobotNum{}, nil, err
+	}
+	// Set up leftOptions.
+	leftOptions := serial.OpenOptions{
+		PortName:          *f.lp,
+		BaudRate:          1250000,
+		DataBits:          8,
+		StopBits:          1,
+		MinimumReadSize:   3,
+		ParityMode:        serial.PARITY_EVEN,
+		RTSCTSFlowControl: false,
+	}
+	rightOptions := leftOptions
+	rightOptions.PortName = *f.rp
+	rightPort, err := serial.Open(rightOptions)
+	if err != nil {
+		return khr_3hv.RobotNum{}, nil, fmt.Errorf("rightPort.Open: %w", err)
+	}
+	leftPort, err := serial.Open(leftOptions)
+	if err != nil {
+		rightPort.Close()
+		return khr_3hv.RobotNum{}, nil, fmt.Errorf("leftPort.Open: %w", err)
+	}
+	closePorts := func() {
+		rightPort.Close()
+		leftPort.Close()
+	}
+	r, err := khr_3hv.NewRobotNum(desc, map[string]io.ReadWriteCloser{
+		"left":  leftPort,
+		"right": rightPort,
+	})
+	if err != nil {
+		closePorts()
+		return khr_3hv.RobotNum{}, nil, err
+	}
+	return r, closePorts, nil
+}
+
+// parseKinds parses a comma separated list of joint numbers or names
+func parseKinds(s string) ([]khr_3hv.Kind, error) {
+	var kinds []khr_3hv.Kind
+	if s == "" {
+		return kinds, nil
+	}
+	for _, v := range strings.Split(s, ",") {
+		kind, err := khr_3hv.ParseKind(v)
+		if err != nil {
+			return nil, err
+		}
+		kinds = append(kinds, kind)
+	}
+	return kinds, nil
+}
+
+// parseJoint parses the joint number or name of a single joint command
+func parseJoint(s string) (khr_3hv.Kind, error) {
+	if s == "" {
+		return 0, fmt.Errorf("joint should be given")
+	}
+	return khr_3hv.ParseKind(s)
+}
+
+// baseName is the file name without directory and extension
+func baseName(path string) string {
+	return strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+}
+
+// confirm asks the operator on stdin
+func confirm(w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
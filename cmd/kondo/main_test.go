@@ -0,0 +1,63 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestCommands checks that every func(args []string) error of the package is a command
+func TestCommands(t *testing.T) {
+	registered := map[string]bool{}
+	for name, cmd := range commands {
+		if cmd.usage == "" || cmd.run == nil {
+			t.Errorf("%s should have a usage and a run function", name)
+			continue
+		}
+		f := runtime.FuncForPC(reflect.ValueOf(cmd.run).Pointer()).Name()
+		registered[f[strings.LastIndex(f, ".")+1:]] = true
+	}
+
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range pkgs["main"].Files {
+		for _, decl := range file.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok || fn.Recv != nil || !isCommand(fn.Type) {
+				continue
+			}
+			if !registered[fn.Name.Name] {
+				t.Errorf("%s should be in commands", fn.Name.Name)
+			}
+		}
+	}
+	if !registered["record"] {
+		t.Error("record should be in commands")
+	}
+}
+
+// isCommand tells whether a function is func([]string) error
+func isCommand(f *ast.FuncType) bool {
+	if f.Params == nil || len(f.Params.List) != 1 || len(f.Params.List[0].Names) > 1 {
+		return false
+	}
+	if f.Results == nil || len(f.Results.List) != 1 {
+		return false
+	}
+	param, ok := f.Params.List[0].Type.(*ast.ArrayType)
+	if !ok || param.Len != nil {
+		return false
+	}
+	elem, ok := param.Elt.(*ast.Ident)
+	result, ok2 := f.Results.List[0].Type.(*ast.Ident)
+	return ok && ok2 && elem.Name == "string" && result.Name == "error"
+}
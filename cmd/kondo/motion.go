@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/kinematics"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+func play(args []string) error {
+	var (
+		fs         = flag.NewFlagSet("play", flag.ExitOnError)
+		robot      = newRobotFlags(fs)
+		speed      = fs.Float64("speed", 1, "speed scale, 2 plays twice as fast")
+		period     = fs.Duration("period", khr_3hv.DefaultControlPeriod, "control period")
+		model      = fs.String("model", "", "kinematic model file, the stock KHR-3HV when empty")
+		collisions = fs.Bool("collisions", false, "stop before a frame where links of -model intersect")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("one motion file should be given")
+	}
+	f, err := khr_3hv.LoadMotionFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	m, err := f.Motion()
+	if err != nil {
+		return err
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	var checks []khr_3hv.PoseCheck
+	if *collisions {
+		mdl, calibration, err := loadKinematics(*model, *robot.desc)
+		if err != nil {
+			return err
+		}
+		checks = append(checks, mdl.CollisionCheck(calibration, &r))
+	}
+	player, err := r.Play(m, *period, checks...)
+	if err != nil {
+		return err
+	}
+	if err := player.SetSpeed(*speed); err != nil {
+		player.Stop()
+		return err
+	}
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	select {
+	case <-interrupt:
+		player.Stop()
+	case <-player.Done():
+	}
+	if err := player.Wait(); err != nil {
+		return err
+	}
+	fmt.Printf("%s played in %v\n", m.Name, m.Duration())
+	return nil
+}
+
+func checkMotion(args []string) error {
+	var (
+		fs         = flag.NewFlagSet("check-motion", flag.ExitOnError)
+		stability  = fs.Bool("stability", false, "flag keyframes where the center of mass is outside the support polygon")
+		collisions = fs.Bool("collisions", false, "flag samples of the interpolated motion where links intersect")
+		period     = fs.Duration("period", khr_3hv.DefaultControlPeriod, "sample period of -collisions")
+		model      = fs.String("model", "", "kinematic model file, the stock KHR-3HV when empty")
+		desc       = fs.String("robot", "", "robot description file, the stock KHR-3HV when empty")
+	)
+	fs.Parse(args)
+	var (
+		mdl         *kinematics.Model
+		calibration kinematics.Calibration
+		problems    int
+	)
+	if *stability || *collisions {
+		var err error
+		if mdl, calibration, err = loadKinematics(*model, *desc); err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args() {
+		f, err := khr_3hv.LoadMotionFile(path)
+		if err != nil {
+			return err
+		}
+		m, err := f.Motion()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s: %s, %d joints, %d keyframes, %d after loops, %v\n",
+			path, f.Name, len(f.Joints), len(f.Keyframes), len(m.Keyframes), m.Duration().Round(time.Millisecond))
+		if *stability {
+			flagged, err := mdl.CheckMotion(calibration, m)
+			if err != nil {
+				return err
+			}
+			for _, i := range flagged {
+				fmt.Printf("  keyframe %d at %v is unstable, center of mass %.1f mm outside %v\n",
+					i.Index, i.Time.Round(time.Millisecond), -i.Stability.Margin, i.Stability.Contacts)
+			}
+			problems += len(flagged)
+		}
+		if *collisions {
+			flagged, err := mdl.CheckMotionCollisions(calibration, m, *period)
+			if err != nil {
+				return err
+			}
+			for _, sample := range flagged {
+				for _, c := range sample.Collisions {
+					fmt.Printf("  at %v %s and %s overlap %.1f mm\n", sample.Time.Round(time.Millisecond), c.A, c.B, c.Depth)
+				}
+			}
+			problems += len(flagged)
+		}
+	}
+	if problems > 0 {
+		return fmt.Errorf("%d unstable keyframes or colliding samples", problems)
+	}
+	return nil
+}
+
+func importCSV(args []string) error {
+	var (
+		fs   = flag.NewFlagSet("import-csv", flag.ExitOnError)
+		name = fs.String("name", "", "motion name, the file name when empty")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: import-csv [-name name] <table.csv> <motion.yaml|motion.json>")
+	}
+	in, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if *name == "" {
+		*name = baseName(fs.Arg(0))
+	}
+	f, err := khr_3hv.ImportCSV(in, *name)
+	if err != nil {
+		return err
+	}
+	return f.Save(fs.Arg(1))
+}
+
+func record(args []string) error {
+	var (
+		fs        = flag.NewFlagSet("record", flag.ExitOnError)
+		robot     = newRobotFlags(fs)
+		joints    = fs.String("joints", "", "comma separated joint numbers or names to record")
+		group     = fs.String("group", "", "joint group to record ("+strings.Join(khr_3hv.GroupNames(), ", ")+")")
+		period    = fs.Duration("period", khr_3hv.DefaultSamplePeriod, "sample period")
+		tolerance = fs.Uint("tolerance", 0, "drop keyframes that are within this many position units of the motion without them, 0 keeps every sample")
+		name      = fs.String("name", "", "motion name, the file name when empty")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: record [flags] <motion.yaml|motion.json>")
+	}
+	kinds, err := parseKinds(*joints)
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 {
+		if *group == "" {
+			return fmt.Errorf("-joints or -group should be given")
+		}
+		if kinds, err = khr_3hv.Group(*group); err != nil {
+			return err
+		}
+	}
+	if *name == "" {
+		*name = baseName(fs.Arg(0))
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	rec, err := r.Record(*name, kinds, *period)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d joints are free, move them by hand and press Enter to stop\n", len(kinds))
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	m, err := rec.Stop()
+	if err != nil {
+		return err
+	}
+	samples := len(m.Keyframes)
+	if *tolerance > 0 {
+		m = khr_3hv.ReduceKeyframes(m, *tolerance)
+	}
+	if err := khr_3hv.NewMotionFile(m).Save(fs.Arg(0)); err != nil {
+		return err
+	}
+	fmt.Printf("%d samples in %v, %d keyframes saved to %s\n", samples, m.Duration().Round(time.Millisecond), len(m.Keyframes), fs.Arg(0))
+	return nil
+}
+
+func mirror(args []string) error {
+	var (
+		fs   = flag.NewFlagSet("mirror", flag.ExitOnError)
+		desc = fs.String("robot", "", "robot description file with the joint calibration, the stock KHR-3HV when empty")
+		name = fs.String("name", "", "name of the mirrored motion, the output file name when empty")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: mirror [flags] <motion> <mirrored motion>")
+	}
+	d, err := loadDescription(*desc)
+	if err != nil {
+		return err
+	}
+	m, err := khr_3hv.NewMirror(d)
+	if err != nil {
+		return err
+	}
+	f, err := khr_3hv.LoadMotionFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	mirrored, err := m.MotionFile(f)
+	if err != nil {
+		return err
+	}
+	mirrored.Name = *name
+	if mirrored.Name == "" {
+		mirrored.Name = baseName(fs.Arg(1))
+	}
+	return mirrored.Save(fs.Arg(1))
+}
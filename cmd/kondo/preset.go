@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/khr_3hv"
+	"os"
+	"sort"
+	"strings"
+)
+
+func preset(args []string) error {
+	var (
+		fs     = flag.NewFlagSet("preset", flag.ExitOnError)
+		robot  = newRobotFlags(fs)
+		file   = fs.String("file", "", "preset file, the embedded presets are used when empty")
+		group  = fs.String("group", "", "joint group, the group of the preset is used when empty ("+strings.Join(khr_3hv.GroupNames(), ", ")+")")
+		joints = fs.String("joints", "", "comma separated joint numbers or names, overrides -group")
+		yes    = fs.Bool("yes", false, "write without asking after the preview")
+	)
+	fs.Parse(args)
+	presets := khr_3hv.DefaultPresets()
+	if *file != "" {
+		data, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return err
+		}
+		if presets, err = khr_3hv.LoadPresets(data); err != nil {
+			return err
+		}
+	}
+	if fs.NArg() != 1 {
+		var names []string
+		for name, p := range presets {
+			names = append(names, fmt.Sprintf("  %-16s %s (%s)", name, p.Description, p.Group))
+		}
+		sort.Strings(names)
+		return fmt.Errorf("one preset should be given:\n%s", strings.Join(names, "\n"))
+	}
+	p, ok := presets[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown preset %q", fs.Arg(0))
+	}
+	kinds, err := parseKinds(*joints)
+	if err != nil {
+		return err
+	}
+	if len(kinds) == 0 && *group != "" {
+		if kinds, err = khr_3hv.Group(*group); err != nil {
+			return err
+		}
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+
+	preview, err := r.PreviewPreset(p, kinds)
+	if err != nil {
+		return err
+	}
+	changed := printPresetResults(preview)
+	if changed == 0 {
+		fmt.Println("servos already match the preset")
+		return nil
+	}
+	if !*yes && !confirm(os.Stdout, fmt.Sprintf("apply %s to %d joints?", p.Name, changed)) {
+		return nil
+	}
+	results, err := r.ApplyPreset(p, kinds)
+	fmt.Println("*** report ***")
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			fmt.Printf("joint %2d, id %2d: FAIL %v (rolled back: %t)\n", result.Kind, result.ID, result.Err, result.RolledBack)
+		case len(result.Changes) == 0:
+			fmt.Printf("joint %2d, id %2d: unchanged\n", result.Kind, result.ID)
+		default:
+			fmt.Printf("joint %2d, id %2d: OK %d fields written and verified\n", result.Kind, result.ID, len(result.Changes))
+		}
+	}
+	return err
+}
+
+func printPresetResults(results []khr_3hv.PresetResult) int {
+	changed := 0
+	for _, result := range results {
+		if len(result.Changes) == 0 {
+			continue
+		}
+		changed++
+		fmt.Printf("*** joint %d, id %d ***\n", result.Kind, result.ID)
+		for _, c := range result.Changes {
+			fmt.Println("  ", c)
+		}
+	}
+	return changed
+}
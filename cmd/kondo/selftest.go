@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"os"
+	"strings"
+)
+
+func selfTest(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("selftest", flag.ExitOnError)
+		robot    = newRobotFlags(fs)
+		defaults = khr_3hv.DefaultSelfTestConfig()
+		config   = khr_3hv.SelfTestConfig{}
+		joints   = fs.String("joints", "", "comma separated joint numbers or names, every joint when empty")
+		yes      = fs.Bool("yes", false, "move joints without asking")
+	)
+	fs.BoolVar(&config.Move, "move", defaults.Move, "move every joint a little, the robot should be on a stand")
+	fs.UintVar(&config.Amplitude, "amplitude", defaults.Amplitude, "positions a joint moves")
+	fs.DurationVar(&config.Settle, "settle", defaults.Settle, "time a joint gets to reach the test position")
+	fs.UintVar(&config.Tolerance, "tolerance", defaults.Tolerance, "positions a joint may stop from the test position")
+	temperature := fs.Uint("temperature", uint(defaults.Temperature), "raw temperature a joint should read above, smaller is hotter")
+	fs.Parse(args)
+	config.Temperature = uint8(*temperature)
+	kinds, err := parseKinds(*joints)
+	if err != nil {
+		return err
+	}
+	r, closePorts, err := robot.open()
+	if err != nil {
+		return err
+	}
+	defer closePorts()
+	if len(kinds) == 0 {
+		kinds = r.Kinds()
+	}
+	if config.Move && !*yes && !confirm(os.Stdout, fmt.Sprintf("every joint will be freed and moved by %d, is the robot on a stand?", config.Amplitude)) {
+		return nil
+	}
+
+	reports := r.SelfTest(kinds, config)
+	fmt.Println("*** report ***")
+	var failed []string
+	for _, report := range reports {
+		result := "PASS"
+		if !report.Passed() {
+			result = "FAIL"
+			failed = append(failed, report.Joint)
+		}
+		fmt.Printf("%-18s id %2d: %s\n", report.Joint, report.ID, result)
+		for _, c := range report.Checks {
+			status := "ok"
+			switch {
+			case c.Skipped:
+				status = "skip"
+			case !c.Passed:
+				status = "FAIL"
+			}
+			fmt.Printf("    %-12s %-4s %s\n", c.Name, status, c.Detail)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d joints failed: %s", len(failed), len(reports), strings.Join(failed, ", "))
+	}
+	fmt.Printf("all %d joints passed\n", len(reports))
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/eeprom"
+	"kondocontrol/internal/khr_3hv"
+	"os"
+)
+
+func urdf(args []string) error {
+	var (
+		fs     = flag.NewFlagSet("urdf", flag.ExitOnError)
+		robot  = newRobotFlags(fs)
+		model  = fs.String("model", "", "kinematic model file, the stock KHR-3HV when empty")
+		backup = fs.String("backup", "", "backup directory to take the EEPROM pulse limits from instead of the robot")
+		out    = fs.String("out", "", "URDF file to write, stdout when empty")
+	)
+	fs.Parse(args)
+	mdl, calibration, err := loadKinematics(*model, *robot.desc)
+	if err != nil {
+		return err
+	}
+	desc, err := loadDescription(*robot.desc)
+	if err != nil {
+		return err
+	}
+
+	// the limits are those of the description, tightened by the EEPROM pulse limits when they can be read
+	var motors khr_3hv.RobotNum
+	for _, kind := range khr_3hv.Kinds() {
+		motors[kind].Joint, _ = desc.Joint(kind.String())
+	}
+	switch {
+	case *backup != "":
+		b, err := khr_3hv.OpenBackup(*backup)
+		if err != nil {
+			return err
+		}
+		for _, entry := range b.Entries {
+			kind := entry.Kind
+			image, err := b.Image(kind)
+			if err != nil {
+				return err
+			}
+			if motors[kind].EEPROM, err = eeprom.Parse(image); err != nil {
+				return fmt.Errorf("%s: %w", kind, err)
+			}
+		}
+	case *robot.lp != "" || *robot.rp != "":
+		r, closePorts, err := robot.open()
+		if err != nil {
+			return err
+		}
+		defer closePorts()
+		if err := r.LoadLimits(); err != nil {
+			return err
+		}
+		motors = r
+	}
+	limits := map[khr_3hv.Kind][2]uint{}
+	for _, kind := range khr_3hv.Kinds() {
+		min, max := motors[kind].Limits()
+		limits[kind] = [2]uint{min, max}
+	}
+
+	data, err := mdl.URDF(calibration, limits)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(*out, data, 0644)
+}
+
+func importURDF(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("import-urdf", flag.ExitOnError)
+		model    = fs.String("model", "", "kinematic model file to start from, the stock KHR-3HV when empty")
+		desc     = fs.String("robot", "", "robot description file to start from, the stock KHR-3HV when empty")
+		modelOut = fs.String("model-out", "", "file to save the model with the link lengths of the URDF")
+		descOut  = fs.String("robot-out", "", "file to save the robot description with the joint limits of the URDF")
+	)
+	fs.Parse(args)
+	if fs.NArg() != 1 || *modelOut == "" && *descOut == "" {
+		return fmt.Errorf("usage: import-urdf [-model model.yaml] [-robot robot.yaml] -model-out model.yaml -robot-out robot.yaml <robot.urdf>")
+	}
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	mdl, calibration, err := loadKinematics(*model, *desc)
+	if err != nil {
+		return err
+	}
+	description, err := loadDescription(*desc)
+	if err != nil {
+		return err
+	}
+	limits, err := mdl.ImportURDF(data)
+	if err != nil {
+		return err
+	}
+	if err := mdl.Validate(); err != nil {
+		return err
+	}
+	if err := calibration.ApplyLimits(description, limits); err != nil {
+		return err
+	}
+	fmt.Printf("%s: limits of %d joints\n", fs.Arg(0), len(limits))
+	if *modelOut != "" {
+		out, err := mdl.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*modelOut, out, 0644); err != nil {
+			return err
+		}
+	}
+	if *descOut != "" {
+		out, err := description.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(*descOut, out, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"kondocontrol/internal/gait"
+	"kondocontrol/internal/khr_3hv"
+	"os"
+	"os/signal"
+)
+
+func walk(args []string) error {
+	var (
+		fs       = flag.NewFlagSet("walk", flag.ExitOnError)
+		robot    = newRobotFlags(fs)
+		defaults = gait.DefaultParams()
+		model    = fs.String("model", "", "kinematic model file, the stock KHR-3HV when empty")
+		out      = fs.String("out", "", "save the walk as a motion file instead of playing it")
+		p        = gait.Params{}
+	)
+	fs.Float64Var(&p.StepLength, "step-length", defaults.StepLength, "mm the body moves forward per step")
+	fs.Float64Var(&p.StepHeight, "step-height", defaults.StepHeight, "mm the swing foot is lifted")
+	fs.DurationVar(&p.CycleTime, "cycle", defaults.CycleTime, "time of two steps")
+	fs.Float64Var(&p.Sway, "sway", defaults.Sway, "mm the body leans over the support foot")
+	fs.Float64Var(&p.Turn, "turn", defaults.Turn, "radians the body turns left per step, negative turns right")
+	fs.Float64Var(&p.Height, "height", defaults.Height, "mm from hip to sole while walking")
+	fs.IntVar(&p.Steps, "steps", defaults.Steps, "number of steps")
+	fs.DurationVar(&p.Period, "period", defaults.Period, "time between keyframes")
+	fs.Parse(args)
+
+	var (
+		g   gait.Generator
+		err error
+	)
+	if g.Model, g.Calibration, err = loadKinematics(*model, *robot.desc); err != nil {
+		return err
+	}
+	// the robot is opened first so that the legs keep inside the EEPROM pulse limits
+	var r khr_3hv.RobotNum
+	if *out == "" {
+		var closePorts func()
+		if r, closePorts, err = robot.open(); err != nil {
+			return err
+		}
+		defer closePorts()
+		if err := r.LoadLimits(); err != nil {
+			return err
+		}
+		g.Calibration = g.Calibration.WithLimits(&r)
+	}
+	m, err := g.Walk("walk", p)
+	if err != nil {
+		return err
+	}
+	if *out != "" {
+		f := khr_3hv.NewMotionFile(m)
+		f.Description = fmt.Sprintf("%d steps of %.0f mm", p.Steps, p.StepLength)
+		return f.Save(*out)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+	// move smoothly from wherever the robot stands into the first pose of the walk,
+	// an interrupt meanwhile stops the walk as soon as it starts
+	player, err := r.Play(khr_3hv.Transition("start", r.Current(m.Kinds()), m.Keyframes[0].Pose, p.CycleTime/2), 0)
+	if err != nil {
+		return err
+	}
+	if err := player.Wait(); err != nil {
+		return err
+	}
+	if player, err = r.Play(m, 0); err != nil {
+		return err
+	}
+	select {
+	case <-interrupt:
+		player.Stop()
+	case <-player.Done():
+		return player.Wait()
+	}
+	// stand up smoothly from wherever the walk was stopped
+	player.Wait()
+	stand := m.Keyframes[len(m.Keyframes)-1].Pose
+	player, err = r.Play(khr_3hv.Transition("stand", r.Current(m.Kinds()), stand, p.CycleTime/2), 0)
+	if err != nil {
+		return err
+	}
+	return player.Wait()
+}
@@ -52,7 +52,7 @@ func main() {
 	defer port2.Close()
 	{ // test readEEPROM
 		// r := readEEPROM(0, scEEPROM, port)
-		// fmt.Println(printHex(r), len(r))
+		// fmt.Println(eeprom.Hex(r), len(r))
 	}
 
 	{ // test setPosition and Free mode
@@ -75,7 +75,7 @@ func main() {
 		// if err != nil {
 		// 	log.Fatal(err)
 		// }
-		// fmt.Println(printHex(dat))
+		// fmt.Println(eeprom.Hex(dat))
 	}
 	{ // convert data address to json
 		// var testingFilePath string = "./Ignore/data"
@@ -133,7 +133,7 @@ func readEEPROM(id uint8, sc subCommand, port io.ReadWriteCloser) []byte {
 		cmd uint8 = 0b10100000 + id
 	)
 	b := []byte{cmd, uint8(sc)}
-	fmt.Println(printHex(b))
+	fmt.Println(eeprom.Hex(b))
 	result := writeAndRead(port, b)
 	if len(result) < 2 {
 		return nil
@@ -239,10 +239,3 @@ func writeAndRead(port io.ReadWriteCloser, b []byte) []byte {
 
 	return data[writeN:readN]
 }
-func printHex(bs []byte) string {
-	sum := ""
-	for _, b := range bs {
-		sum += fmt.Sprintf("%X", b) + " "
-	}
-	return sum
-}
@@ -24,6 +24,6 @@ func New(position uint) Position {
 
 func uintToPos(position uint) (uint8, uint8) {
 	posH := uint8((position >> 7) & 0b01111111)
-	posL := uint8(position & 0x01111111)
+	posL := uint8(position & 0b01111111)
 	return posH, posL
 }
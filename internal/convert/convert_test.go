@@ -0,0 +1,19 @@
+package convert
+
+import "testing"
+
+func TestUintToPos(t *testing.T) {
+	for position := uint(0); position < 1<<14; position++ {
+		posH, posL := uintToPos(position)
+		if posH > 0x7F || posL > 0x7F {
+			t.Fatalf("%d: every byte should be 7 bits, actual %#x %#x", position, posH, posL)
+		}
+		p := Position{PosH: posH, PosL: posL}
+		if p.PosToUint() != position {
+			t.Fatalf("%d should round trip, actual %d", position, p.Origin)
+		}
+	}
+	if posH, posL := uintToPos(7500); posH != 0x3A || posL != 0x4C {
+		t.Errorf("7500 should be 0x3A 0x4C, actual %#x %#x", posH, posL)
+	}
+}
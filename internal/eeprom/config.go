@@ -1,6 +0,0 @@
-package eeprom
-
-var (
-	buildAddress    bool   = true
-	testingFilePath string = "./Ignore/data"
-)
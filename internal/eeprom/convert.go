@@ -1,10 +1,30 @@
 package eeprom
 
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Every byte of the EEPROM only holds a nibble,
+// a value is split into nibbles from the high one to the low one.
+func checkNibbles(bs []byte) error {
+	for _, b := range bs {
+		if b > 0x0F {
+			return errors.Wrapf(ErrDataMismatch, "%X is not a nibble, data: %v", b, bs)
+		}
+	}
+	return nil
+}
+
 // Kondo for uint8
 func sliceByteToUint8(bs []byte) (uint8, error) {
 	if len(bs) != 2 {
 		return 0, ErrDataLength
 	}
+	if err := checkNibbles(bs); err != nil {
+		return 0, err
+	}
 	return uint8((bs[0] << 4) + bs[1]), nil
 }
 func uint8ToSliceByte(u uint8) []byte {
@@ -13,30 +33,36 @@ func uint8ToSliceByte(u uint8) []byte {
 	return []byte{high, low}
 }
 
-// Kondo for int8
+// Kondo for int8, the high bit is the sign and the others are the magnitude
 func sliceByteToInt8(bs []byte) (int8, error) {
 	if len(bs) != 2 {
 		return 0, ErrDataLength
 	}
+	if err := checkNibbles(bs); err != nil {
+		return 0, err
+	}
 	value := (bs[0]<<4)&0b01110000 + bs[1]
 	if (bs[0]<<4)&0b10000000 == 0 {
 		return int8(value), nil
 	}
+	if value == 0 {
+		// -0 can't be composed back
+		return 0, errors.Wrapf(ErrDataMismatch, "negative zero, data: %v", bs)
+	}
 	return -int8(value), nil
 }
 func int8ToSliceByte(i int8) []byte {
 	var (
-		high    byte
-		low     byte
-		signBit byte = 0
+		magnitude = uint8(i)
+		signBit   byte
 	)
 	if i < 0 {
-		i--
-		i = ^i
+		// -128 has no sign-magnitude form, the layout keeps it out
+		magnitude = uint8(-int16(i))
 		signBit = 1 << 3
 	}
-	high = (byte(i)&0xF0)>>4 + signBit
-	low = byte(i) & 0x0F
+	high := (magnitude&0x70)>>4 + signBit
+	low := magnitude & 0x0F
 	return []byte{high, low}
 }
 
@@ -45,6 +71,9 @@ func sliceByteToUint16(bs []byte) (uint16, error) {
 	if len(bs) != 4 {
 		return 0, ErrDataLength
 	}
+	if err := checkNibbles(bs); err != nil {
+		return 0, err
+	}
 	zero := uint16(bs[0]) << (4 * 3)
 	one := uint16(bs[1]) << (4 * 2)
 	two := uint16(bs[2]) << (4 * 1)
@@ -59,15 +88,28 @@ func uint16ToSliceByte(u uint16) []byte {
 	return []byte{zero, one, two, three}
 }
 
-// Kondo Flag
-func sliceByteToFlag(b []byte) Flag {
+// Kondo Flag, bit 1 and 2 of the high nibble are always 0
+// and bit 2 of the low nibble is always 1
+func sliceByteToFlag(b []byte) (Flag, error) {
+	if len(b) != 2 {
+		return Flag{}, ErrDataLength
+	}
+	if err := checkNibbles(b); err != nil {
+		return Flag{}, err
+	}
+	if b[0]&0b00000110 != 0 {
+		return Flag{}, errors.Wrapf(ErrDataMismatch, "flagDetail: %b\n", b)
+	}
+	if (b[1] & 0b00000100 >> 2) != 1 {
+		return Flag{}, errors.Wrapf(ErrDataMismatch, "flagDetail[1]&0b00000100 != 1,actual: %v, data: %v", b[1]&0b00000100, b)
+	}
 	return Flag{
 		SlaveMode:    b[0]&0b00001000>>3 == 1,
 		RotationMode: b[0]&0b00000001 == 1,
 		PWMINH:       b[1]&0b00001000>>3 == 1,
 		Free:         b[1]&0b00000010>>1 == 1,
 		Reverse:      b[1]&0b00000001 == 1,
-	}
+	}, nil
 }
 func flagToSliceByte(flag Flag) []byte {
 	var (
@@ -98,10 +140,109 @@ func flagToSliceByte(flag Flag) []byte {
 	}
 }
 
-// SignalSpeed
-// func sliceByteToSignalSpeed(b []byte) SignalSpeed {
-// 	b[0] >> 3
-// }
+// Kondo SignalSpeed is the first nibble, the second one is always 0
+func sliceByteToSignalSpeed(b []byte) (SignalSpeed, error) {
+	if len(b) != 2 {
+		return 0, ErrDataLength
+	}
+	if err := checkNibbles(b); err != nil {
+		return 0, err
+	}
+	s := SignalSpeed(b[0])
+	if b[1] != 0 || !s.Valid() {
+		return 0, errors.Wrapf(ErrDataMismatch, "unknown signal speed, data: %v", b)
+	}
+	return s, nil
+}
 func signalSpeedToSliceByte(s SignalSpeed) []byte {
 	return []byte{byte(s), 0}
 }
+
+// Kondo nibbles of any length for signatures
+func sliceByteToUint(bs []byte) (uint16, error) {
+	if len(bs) == 0 || len(bs) > 4 {
+		return 0, ErrDataLength
+	}
+	if err := checkNibbles(bs); err != nil {
+		return 0, err
+	}
+	var value uint16
+	for _, b := range bs {
+		value = value<<4 + uint16(b)
+	}
+	return value, nil
+}
+
+// Codec names how a field is packed into nibbles
+type Codec string
+
+const (
+	CodecUint8       Codec = "uint8"
+	CodecUint16      Codec = "uint16"
+	CodecInt8        Codec = "int8"
+	CodecFlag        Codec = "flag"
+	CodecSignalSpeed Codec = "signal-speed"
+)
+
+// codec converts one field between Kondo nibbles and its Go value,
+// numeric codecs are range checked with the min, max and step of the layout
+type codec struct {
+	size    uint8
+	typ     reflect.Type
+	numeric bool
+	decode  func(bs []byte) (reflect.Value, error)
+	encode  func(v reflect.Value) []byte
+	valid   func(v reflect.Value) bool
+}
+
+var codecs = map[Codec]codec{
+	CodecUint8: {
+		size:    2,
+		typ:     reflect.TypeOf(uint8(0)),
+		numeric: true,
+		decode: func(bs []byte) (reflect.Value, error) {
+			u, err := sliceByteToUint8(bs)
+			return reflect.ValueOf(u), err
+		},
+		encode: func(v reflect.Value) []byte { return uint8ToSliceByte(uint8(v.Uint())) },
+	},
+	CodecUint16: {
+		size:    4,
+		typ:     reflect.TypeOf(uint16(0)),
+		numeric: true,
+		decode: func(bs []byte) (reflect.Value, error) {
+			u, err := sliceByteToUint16(bs)
+			return reflect.ValueOf(u), err
+		},
+		encode: func(v reflect.Value) []byte { return uint16ToSliceByte(uint16(v.Uint())) },
+	},
+	CodecInt8: {
+		size:    2,
+		typ:     reflect.TypeOf(int8(0)),
+		numeric: true,
+		decode: func(bs []byte) (reflect.Value, error) {
+			i, err := sliceByteToInt8(bs)
+			return reflect.ValueOf(i), err
+		},
+		encode: func(v reflect.Value) []byte { return int8ToSliceByte(int8(v.Int())) },
+	},
+	CodecFlag: {
+		size: 2,
+		typ:  reflect.TypeOf(Flag{}),
+		decode: func(bs []byte) (reflect.Value, error) {
+			flag, err := sliceByteToFlag(bs)
+			return reflect.ValueOf(flag), err
+		},
+		encode: func(v reflect.Value) []byte { return flagToSliceByte(v.Interface().(Flag)) },
+	},
+	CodecSignalSpeed: {
+		size: 2,
+		typ:  reflect.TypeOf(SignalSpeed(0)),
+		decode: func(bs []byte) (reflect.Value, error) {
+			s, err := sliceByteToSignalSpeed(bs)
+			return reflect.ValueOf(s), err
+		},
+		encode: func(v reflect.Value) []byte { return signalSpeedToSliceByte(SignalSpeed(v.Uint())) },
+		valid:  func(v reflect.Value) bool { return SignalSpeed(v.Uint()).Valid() },
+	},
+}
@@ -1,6 +1,10 @@
 package eeprom
 
-import "testing"
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
 
 func TestInt8ToSliceByte(t *testing.T) {
 	const (
@@ -59,3 +63,70 @@ func TestUint16ToSliceByte(t *testing.T) {
 		}
 	}
 }
+
+func TestSignalSpeedRoundTrip(t *testing.T) {
+	for _, s := range []SignalSpeed{High, Mid, Low} {
+		result, err := sliceByteToSignalSpeed(signalSpeedToSliceByte(s))
+		if err != nil {
+			t.Fatalf("%v: %+v", s, err)
+		}
+		if result != s {
+			t.Errorf("result: %v doesn't equal s: %v", result, s)
+		}
+	}
+	if _, err := sliceByteToSignalSpeed([]byte{0x02, 0}); err == nil {
+		t.Error("This should be fail, becouse 2 is not a signal speed")
+	}
+	if _, err := sliceByteToSignalSpeed([]byte{0x01, 0x01}); err == nil {
+		t.Error("This should be fail, becouse the second nibble is always 0")
+	}
+}
+
+func TestInt8RoundTrip(t *testing.T) {
+	for i := -127; i <= 127; i++ {
+		result, err := sliceByteToInt8(int8ToSliceByte(int8(i)))
+		if err != nil {
+			t.Fatalf("%d: %+v", i, err)
+		}
+		if int(result) != i {
+			t.Errorf("result: %d doesn't equal i: %d", result, i)
+		}
+	}
+	if _, err := sliceByteToInt8([]byte{0x08, 0}); err == nil {
+		t.Error("This should be fail, becouse negative zero can't be composed back")
+	}
+}
+
+// TestParseComposeRoundTrip checks that composing a parsed image gives back the same image,
+// for the dump and every image that differs from it by one nibble
+func TestParseComposeRoundTrip(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs := make([]byte, len(dat))
+	for i := range dat {
+		for nibble := byte(0); nibble <= 0x0F; nibble++ {
+			copy(bs, dat)
+			bs[i] = nibble
+			ee, err := Parse(bs)
+			if err != nil {
+				continue
+			}
+			composed, err := Compose(bs, ee)
+			if err != nil {
+				t.Fatalf("valid image can't be composed: %+v\norigin: %v", err, bs)
+			}
+			if !bytes.Equal(composed, bs) {
+				t.Fatalf("not equal\norigin:   %v\ncomposed: %v", bs, composed)
+			}
+			again, err := Parse(composed)
+			if err != nil {
+				t.Fatalf("%+v", err)
+			}
+			if again != ee {
+				t.Fatalf("not equal\nparse:   %+v\nreparse: %+v", ee, again)
+			}
+		}
+	}
+}
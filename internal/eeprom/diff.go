@@ -0,0 +1,51 @@
+package eeprom
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Change is one field that differs between two EEPROM
+type Change struct {
+	Field string      `json:"field"`
+	From  interface{} `json:"from"`
+	To    interface{} `json:"to"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.From, c.To)
+}
+
+// Diff lists every setting that differs from a to b,
+// Flag bits are reported one by one as Flag.<bit>
+func Diff(a, b EEPROM) []Change {
+	var (
+		changes []Change
+		va      = reflect.ValueOf(a)
+		vb      = reflect.ValueOf(b)
+		t       = va.Type()
+	)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Type == reflect.TypeOf(Address{}) {
+			continue
+		}
+		fa, fb := va.Field(i), vb.Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			for j := 0; j < field.Type.NumField(); j++ {
+				if fa.Field(j).Interface() != fb.Field(j).Interface() {
+					changes = append(changes, Change{
+						Field: field.Name + "." + field.Type.Field(j).Name,
+						From:  fa.Field(j).Interface(),
+						To:    fb.Field(j).Interface(),
+					})
+				}
+			}
+			continue
+		}
+		if fa.Interface() != fb.Interface() {
+			changes = append(changes, Change{Field: field.Name, From: fa.Interface(), To: fb.Interface()})
+		}
+	}
+	return changes
+}
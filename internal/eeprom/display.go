@@ -1,13 +1,162 @@
 package eeprom
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
 
-func print(target map[string][]byte) {
-	for k, v := range target {
-		fmt.Printf("*** %s ***\n", k)
-		for i := v[0]; i < v[len(v)-1]; i++ {
-			fmt.Print(i, " ")
+	"github.com/pkg/errors"
+)
+
+// Formats of Inspection.Render, JSON is shared with Document
+const (
+	Text     Format = "text"
+	Markdown Format = "markdown"
+)
+
+// Hex prints every byte as hex, split by space
+func Hex(bs []byte) string {
+	sum := ""
+	for _, b := range bs {
+		sum += fmt.Sprintf("%X", b) + " "
+	}
+	return sum
+}
+
+// Row is one annotated interval of an EEPROM image
+type Row struct {
+	Start uint8  `json:"start"`
+	End   uint8  `json:"end"`
+	Raw   string `json:"raw"`
+	Field string `json:"field"`
+	Value string `json:"value"`
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+// Inspection is an EEPROM image annotated by its layout
+type Inspection struct {
+	Layout  string `json:"layout"`
+	Version int    `json:"version"`
+	Note    string `json:"note,omitempty"`
+	Known   bool   `json:"known"`
+	Valid   bool   `json:"valid"`
+	Rows    []Row  `json:"rows"`
+}
+
+// Inspect annotates every interval of bs, unlike Parse it doesn't stop at the
+// first illegal field. Data of an unknown layout is shown with the default one.
+func Inspect(bs []byte) (Inspection, error) {
+	if len(bs) != 64 {
+		return Inspection{}, ErrDataLength
+	}
+	layout, err := Detect(bs)
+	known := err == nil
+	if !known {
+		layout = DefaultLayout()
+	}
+	result := Inspection{Layout: layout.Name, Version: layout.Version, Note: layout.Note, Known: known, Valid: true}
+	add := func(start, end uint8, name, value string, err error) {
+		row := Row{Start: start, End: end, Raw: strings.TrimSpace(Hex(bs[start:end])), Field: name, Value: value, Valid: err == nil}
+		if err != nil {
+			row.Error = err.Error()
+			result.Valid = false
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	for _, s := range layout.Signature {
+		value, err := sliceByteToUint(bs[s.Start:s.End])
+		if err == nil && value != s.Value {
+			err = errors.Errorf("should be %X", s.Value)
+		}
+		add(s.Start, s.End, s.Name, fmt.Sprintf("%X", value), err)
+	}
+	for _, r := range layout.Reserved {
+		add(r.Start, r.End, "reserved", "", nil)
+	}
+	for _, f := range layout.Fields {
+		value, err := codecs[f.Codec].decode(bs[f.Start:f.End])
+		if err == nil {
+			err = f.check(value)
+		}
+		text := ""
+		if value.IsValid() {
+			text = formatValue(value)
+			if f.Unit != "" {
+				text += " (" + f.Unit + ")"
+			}
+		}
+		add(f.Start, f.End, f.Name, text, err)
+	}
+	sort.Slice(result.Rows, func(i, j int) bool { return result.Rows[i].Start < result.Rows[j].Start })
+	return result, nil
+}
+
+func formatValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case Flag:
+		var bits []string
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if v.Field(i).Bool() {
+				bits = append(bits, t.Field(i).Name)
+			}
+		}
+		if len(bits) == 0 {
+			return "none"
+		}
+		return strings.Join(bits, ", ")
+	case SignalSpeed:
+		return value.String()
+	case int8:
+		return strconv.Itoa(int(value))
+	}
+	return strconv.FormatUint(v.Uint(), 10)
+}
+
+// Render writes the inspection as Text, Markdown or JSON
+func (i Inspection) Render(w io.Writer, f Format) error {
+	valid := func(r Row) string {
+		if r.Valid {
+			return "ok"
+		}
+		return "INVALID " + r.Error
+	}
+	title := fmt.Sprintf("layout %s v%d", i.Layout, i.Version)
+	if !i.Known {
+		title += ", signature doesn't match, shown with the default layout"
+	} else if i.Note != "" {
+		title += ", " + i.Note
+	}
+	switch f {
+	case Text:
+		fmt.Fprintln(w, title)
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "OFFSET\tRAW\tFIELD\tVALUE\tVALID")
+		for _, r := range i.Rows {
+			fmt.Fprintf(tw, "%02d-%02d\t%s\t%s\t%s\t%s\n", r.Start, r.End-1, r.Raw, r.Field, r.Value, valid(r))
+		}
+		return tw.Flush()
+	case Markdown:
+		fmt.Fprintf(w, "**%s**\n\n", title)
+		fmt.Fprintln(w, "| Offset | Raw | Field | Value | Valid |")
+		fmt.Fprintln(w, "|---|---|---|---|---|")
+		for _, r := range i.Rows {
+			fmt.Fprintf(w, "| %02d-%02d | `%s` | %s | %s | %s |\n", r.Start, r.End-1, r.Raw, r.Field, r.Value, valid(r))
+		}
+		return nil
+	case JSON:
+		b, err := json.MarshalIndent(i, "", "    ")
+		if err != nil {
+			return errors.WithStack(err)
 		}
-		println()
+		_, err = fmt.Fprintln(w, string(b))
+		return err
 	}
+	return errors.Errorf("unknown format %q", f)
 }
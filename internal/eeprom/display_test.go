@@ -0,0 +1,52 @@
+package eeprom
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dat[6], dat[7] = 0x0F, 0x0F // punch 255
+	inspection, err := Inspect(dat)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if inspection.Valid {
+		t.Error("inspection should not be valid")
+	}
+	invalid := 0
+	covered := 0
+	for _, r := range inspection.Rows {
+		covered += int(r.End - r.Start)
+		if !r.Valid {
+			invalid++
+			if r.Field != "punch" {
+				t.Errorf("only punch should be invalid, actual %s", r.Field)
+			}
+		}
+	}
+	if invalid != 1 {
+		t.Errorf("one row should be invalid, actual %d", invalid)
+	}
+	if covered != 64 {
+		t.Errorf("rows should cover 64 bytes, actual %d", covered)
+	}
+	for _, f := range []Format{Text, Markdown, JSON} {
+		var buf bytes.Buffer
+		if err := inspection.Render(&buf, f); err != nil {
+			t.Fatalf("%s: %+v", f, err)
+		}
+		if !strings.Contains(buf.String(), "characteristic-change-stretch3") {
+			t.Errorf("%s: every field should be rendered\n%s", f, buf.String())
+		}
+		if !strings.Contains(buf.String(), "not told apart") {
+			t.Errorf("%s: the layout note should be rendered\n%s", f, buf.String())
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package eeprom
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is an on-disk format of Document
+type Format string
+
+const (
+	JSON Format = "json"
+	YAML Format = "yaml"
+)
+
+// FormatFromPath picks the format by the file extension
+func FormatFromPath(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	}
+	return "", errors.Errorf("unknown EEPROM document extension %q", filepath.Ext(path))
+}
+
+// Document is the human-readable form of EEPROM,
+// every value is named and Units annotates the ones that have a unit
+type Document struct {
+	ID                           uint8             `json:"id" yaml:"id"`
+	StretchGain                  uint8             `json:"stretch-gain" yaml:"stretch-gain"`
+	Speed                        uint8             `json:"speed" yaml:"speed"`
+	Punch                        uint8             `json:"punch" yaml:"punch"`
+	DeadBand                     uint8             `json:"dead-band" yaml:"dead-band"`
+	Damping                      uint8             `json:"damping" yaml:"damping"`
+	SafeTimer                    uint8             `json:"safe-timer" yaml:"safe-timer"`
+	Flag                         Flag              `json:"flag" yaml:"flag"`
+	MaximumPulseLimit            uint16            `json:"maximum-pulse-limit" yaml:"maximum-pulse-limit"`
+	MinimumPulseLimit            uint16            `json:"minimum-pulse-limit" yaml:"minimum-pulse-limit"`
+	SignalSpeed                  SignalSpeed       `json:"signal-speed" yaml:"signal-speed"`
+	TemperatureLimit             uint8             `json:"temperature-limit" yaml:"temperature-limit"`
+	CurrentLimit                 uint8             `json:"current-limit" yaml:"current-limit"`
+	Response                     uint8             `json:"response" yaml:"response"`
+	UserOffset                   int8              `json:"user-offset" yaml:"user-offset"`
+	CharacteristicChangeStretch1 uint8             `json:"characteristic-change-stretch1" yaml:"characteristic-change-stretch1"`
+	CharacteristicChangeStretch2 uint8             `json:"characteristic-change-stretch2" yaml:"characteristic-change-stretch2"`
+	CharacteristicChangeStretch3 uint8             `json:"characteristic-change-stretch3" yaml:"characteristic-change-stretch3"`
+	Units                        map[string]string `json:"units,omitempty" yaml:"units,omitempty"`
+}
+
+// NewDocument converts e to Document
+func NewDocument(e EEPROM) Document {
+	// units are only written out for the reader, Import ignores them
+	units := map[string]string{}
+	for _, f := range DefaultLayout().Fields {
+		if f.Unit != "" {
+			units[f.Name] = f.Unit
+		}
+	}
+	return Document{
+		ID:                           e.ID,
+		StretchGain:                  e.StretchGain,
+		Speed:                        e.Speed,
+		Punch:                        e.Punch,
+		DeadBand:                     e.DeadBand,
+		Damping:                      e.Damping,
+		SafeTimer:                    e.SafeTimer,
+		Flag:                         e.Flag,
+		MaximumPulseLimit:            e.MaximumPulseLimit,
+		MinimumPulseLimit:            e.MinimumPulseLimit,
+		SignalSpeed:                  e.SignalSpeed,
+		TemperatureLimit:             e.TemperatureLimit,
+		CurrentLimit:                 e.CurrentLimit,
+		Response:                     e.Response,
+		UserOffset:                   e.UserOffset,
+		CharacteristicChangeStretch1: e.CharacteristicChangeStretch1,
+		CharacteristicChangeStretch2: e.CharacteristicChangeStretch2,
+		CharacteristicChangeStretch3: e.CharacteristicChangeStretch3,
+		Units:                        units,
+	}
+}
+
+// EEPROM converts d back to EEPROM and validates it
+func (d Document) EEPROM() (EEPROM, error) {
+	e := EEPROM{
+		ID:                           d.ID,
+		StretchGain:                  d.StretchGain,
+		Speed:                        d.Speed,
+		Punch:                        d.Punch,
+		DeadBand:                     d.DeadBand,
+		Damping:                      d.Damping,
+		SafeTimer:                    d.SafeTimer,
+		Flag:                         d.Flag,
+		MaximumPulseLimit:            d.MaximumPulseLimit,
+		MinimumPulseLimit:            d.MinimumPulseLimit,
+		SignalSpeed:                  d.SignalSpeed,
+		TemperatureLimit:             d.TemperatureLimit,
+		CurrentLimit:                 d.CurrentLimit,
+		Response:                     d.Response,
+		UserOffset:                   d.UserOffset,
+		CharacteristicChangeStretch1: d.CharacteristicChangeStretch1,
+		CharacteristicChangeStretch2: d.CharacteristicChangeStretch2,
+		CharacteristicChangeStretch3: d.CharacteristicChangeStretch3,
+	}
+	if err := e.Validate(); err != nil {
+		return EEPROM{}, err
+	}
+	return e, nil
+}
+
+// Export encodes e as an annotated document
+func Export(e EEPROM, f Format) ([]byte, error) {
+	doc := NewDocument(e)
+	switch f {
+	case JSON:
+		b, err := json.MarshalIndent(doc, "", "    ")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return append(b, '\n'), nil
+	case YAML:
+		b, err := yaml.Marshal(doc)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return b, nil
+	}
+	return nil, errors.Errorf("unknown format %q", f)
+}
+
+// Import decodes a document written by Export or by hand.
+// Unknown or missing fields are rejected and every value is validated.
+func Import(data []byte, f Format) (EEPROM, error) {
+	var (
+		doc    Document
+		fields map[string]interface{}
+	)
+	switch f {
+	case JSON:
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&doc); err != nil {
+			return EEPROM{}, errors.Wrap(err, "[Import]")
+		}
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return EEPROM{}, errors.Wrap(err, "[Import]")
+		}
+	case YAML:
+		if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+			return EEPROM{}, errors.Wrap(err, "[Import]")
+		}
+		if err := yaml.Unmarshal(data, &fields); err != nil {
+			return EEPROM{}, errors.Wrap(err, "[Import]")
+		}
+	default:
+		return EEPROM{}, errors.Errorf("unknown format %q", f)
+	}
+	for _, name := range documentFields() {
+		if _, ok := fields[name]; !ok {
+			return EEPROM{}, errors.Errorf("[Import] field %q is missing", name)
+		}
+	}
+	e, err := doc.EEPROM()
+	if err != nil {
+		return EEPROM{}, errors.Wrap(err, "[Import]")
+	}
+	return e, nil
+}
+
+// documentFields lists the json names of the required fields of Document
+func documentFields() []string {
+	var (
+		names []string
+		t     = reflect.TypeOf(Document{})
+	)
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("json"), ",")
+		if len(tag) > 1 && tag[1] == "omitempty" {
+			continue
+		}
+		names = append(names, tag[0])
+	}
+	return names
+}
@@ -0,0 +1,61 @@
+package eeprom
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestExportImport(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ee, err := Parse(dat)
+	if err != nil {
+		t.Fatalf("%+v\n", err)
+	}
+	ee.Address = Address{}
+	for _, f := range []Format{JSON, YAML} {
+		doc, err := Export(ee, f)
+		if err != nil {
+			t.Fatalf("%s: %+v\n", f, err)
+		}
+		if !strings.Contains(string(doc), "signal-speed") || !strings.Contains(string(doc), ee.SignalSpeed.String()) {
+			t.Errorf("%s: signal speed should be written by name\n%s", f, doc)
+		}
+		result, err := Import(doc, f)
+		if err != nil {
+			t.Fatalf("%s: %+v\n", f, err)
+		}
+		if result != ee {
+			t.Errorf("%s: not equal\nimport: %+v\norigin: %+v", f, result, ee)
+		}
+	}
+}
+
+func TestImportValidation(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ee, err := Parse(dat)
+	if err != nil {
+		t.Fatalf("%+v\n", err)
+	}
+	doc, err := Export(ee, YAML)
+	if err != nil {
+		t.Fatalf("%+v\n", err)
+	}
+	cases := map[string]string{
+		"out of range":  strings.Replace(string(doc), "punch: ", "punch: 9", 1),
+		"unknown enum":  strings.Replace(string(doc), "signal-speed: "+ee.SignalSpeed.String(), "signal-speed: Fast", 1),
+		"unknown field": string(doc) + "stretch: 10\n",
+		"missing field": strings.Replace(string(doc), "damping:", "# damping:", 1),
+	}
+	for name, c := range cases {
+		if _, err := Import([]byte(c), YAML); err == nil {
+			t.Errorf("%s: this should be fail\n%s", name, c)
+		}
+	}
+}
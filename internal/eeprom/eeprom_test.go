@@ -3,27 +3,19 @@ package eeprom
 import (
 	"bytes"
 	"encoding/json"
-	"fmt"
 	"io/ioutil"
 	"testing"
 
 	"github.com/pkg/errors"
 )
 
-func printHex(bs []byte) string {
-	sum := ""
-	for _, b := range bs {
-		sum += fmt.Sprintf("%X", b) + " "
-	}
-	return sum
-}
 func Test(t *testing.T) {
 	testingFilePath := "./data"
 	dat, err := ioutil.ReadFile(testingFilePath)
 	if err != nil {
 		t.Error(err)
 	}
-	t.Log(string(printHex(dat)))
+	t.Log(Hex(dat))
 	eeprom, err := Parse(dat)
 	if err != nil {
 		t.Fatalf("%+v\n", err)
@@ -65,14 +57,14 @@ func TestCompose(t *testing.T) {
 		copy(sourceData, source)
 
 		// log out before data
-		// t.Logf("*** Before Data ***\n%+v\n", printHex(sourceData))
+		// t.Logf("*** Before Data ***\n%+v\n", Hex(sourceData))
 		// Compose data
 		composeData, err := Compose(sourceData, targetEEPROM)
 		if err != nil {
 			return err
 		}
 		// log out after data
-		// t.Logf("*** After Data ***\n%+v\n", printHex(composeData))
+		// t.Logf("*** After Data ***\n%+v\n", Hex(composeData))
 		// checking compose data equal targetEEPROM
 		composeEEPROM, err := Parse(composeData)
 		if err != nil {
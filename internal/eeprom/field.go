@@ -0,0 +1,173 @@
+package eeprom
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownField is when no EEPROM field has the name
+var ErrUnknownField = errors.New("Unknown EEPROM field")
+
+// FieldInfo describes one setting that can be read or changed by name,
+// a Flag bit is a field of its own named Flag.<bit>
+type FieldInfo struct {
+	Name    string   `json:"name"`
+	Type    string   `json:"type"`
+	Min     int      `json:"min"`
+	Max     int      `json:"max"`
+	Step    int      `json:"step,omitempty"`
+	Values  []string `json:"values,omitempty"`
+	Unit    string   `json:"unit,omitempty"`
+	Address Interval `json:"address"`
+}
+
+// field is where a FieldInfo points to in EEPROM
+type field struct {
+	info   FieldInfo
+	layout FieldLayout
+	index  []int
+}
+
+// Fields lists every named setting of the default layout
+func Fields() []FieldInfo {
+	var result []FieldInfo
+	for _, f := range fieldsOf(DefaultLayout()) {
+		result = append(result, f.info)
+	}
+	return result
+}
+
+func fieldsOf(l *Layout) []field {
+	var (
+		result []field
+		t      = reflect.TypeOf(EEPROM{})
+	)
+	for _, f := range l.Fields {
+		structField := t.Field(eepromIndex[f.Name])
+		info := FieldInfo{
+			Name:    structField.Name,
+			Type:    structField.Type.Kind().String(),
+			Min:     f.Min,
+			Max:     f.Max,
+			Step:    f.Step,
+			Unit:    f.Unit,
+			Address: NewInterval(f.Start, f.End),
+		}
+		switch f.Codec {
+		case CodecFlag:
+			for i := 0; i < structField.Type.NumField(); i++ {
+				result = append(result, field{
+					info: FieldInfo{
+						Name:    structField.Name + "." + structField.Type.Field(i).Name,
+						Type:    "bool",
+						Max:     1,
+						Address: info.Address,
+					},
+					layout: f,
+					index:  []int{structField.Index[0], i},
+				})
+			}
+			continue
+		case CodecSignalSpeed:
+			info.Type = "enum"
+			for _, s := range []SignalSpeed{High, Mid, Low} {
+				info.Values = append(info.Values, s.String())
+			}
+		}
+		result = append(result, field{info: info, layout: f, index: structField.Index})
+	}
+	return result
+}
+
+// lookupField accepts the Go name (Punch, Flag.Reverse)
+// or the layout name (punch, flag.reverse), in any case
+func lookupField(name string) (field, error) {
+	for _, f := range fieldsOf(DefaultLayout()) {
+		if strings.EqualFold(f.info.Name, name) {
+			return f, nil
+		}
+		key := f.layout.Name
+		if len(f.index) > 1 {
+			key += f.info.Name[strings.Index(f.info.Name, "."):]
+		}
+		if strings.EqualFold(key, name) {
+			return f, nil
+		}
+	}
+	return field{}, errors.Wrapf(ErrUnknownField, "%q", name)
+}
+
+// Get returns the value of the field as text
+func (e EEPROM) Get(name string) (string, error) {
+	f, err := lookupField(name)
+	if err != nil {
+		return "", err
+	}
+	v := reflect.ValueOf(e).FieldByIndex(f.index)
+	switch v.Kind() {
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int8:
+		return strconv.FormatInt(v.Int(), 10), nil
+	}
+	if f.info.Type == "enum" {
+		return v.Interface().(SignalSpeed).String(), nil
+	}
+	return strconv.FormatUint(v.Uint(), 10), nil
+}
+
+// Set parses value for the field and changes it only if it is legal
+func (e *EEPROM) Set(name, value string) error {
+	f, err := lookupField(name)
+	if err != nil {
+		return err
+	}
+	value = strings.TrimSpace(value)
+	v := reflect.ValueOf(e).Elem().FieldByIndex(f.index)
+	parsed := reflect.New(v.Type()).Elem()
+	switch {
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return errors.Wrapf(ErrDataMismatch, "%s should be true or false, but actual is %q", f.info.Name, value)
+		}
+		parsed.SetBool(b)
+	case f.info.Type == "enum":
+		var s SignalSpeed
+		if err := s.UnmarshalText([]byte(value)); err != nil {
+			return errors.Wrapf(ErrDataMismatch, "%s: %v", f.info.Name, err)
+		}
+		parsed.SetUint(uint64(s))
+	case v.Kind() == reflect.Int8:
+		i, err := strconv.ParseInt(value, 0, 8)
+		if err != nil {
+			return errors.Wrapf(ErrDataMismatch, "%s should be an integer, but actual is %q", f.info.Name, value)
+		}
+		parsed.SetInt(i)
+	default:
+		u, err := strconv.ParseUint(value, 0, v.Type().Bits())
+		if err != nil {
+			return errors.Wrapf(ErrDataMismatch, "%s should be an unsigned integer, but actual is %q", f.info.Name, value)
+		}
+		parsed.SetUint(u)
+	}
+	if len(f.index) == 1 {
+		if err := f.layout.check(parsed); err != nil {
+			return err
+		}
+	}
+	v.Set(parsed)
+	return nil
+}
+
+// Apply sets a field from an assignment like Punch=4 or Flag.Reverse=true
+func (e *EEPROM) Apply(assignment string) error {
+	kv := strings.SplitN(assignment, "=", 2)
+	if len(kv) != 2 {
+		return errors.Errorf("%q should be <field>=<value>", assignment)
+	}
+	return e.Set(strings.TrimSpace(kv[0]), kv[1])
+}
@@ -0,0 +1,49 @@
+package eeprom
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestFieldGetSet(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ee, err := Parse(dat)
+	if err != nil {
+		t.Fatalf("%+v\n", err)
+	}
+	for _, assignment := range []string{"Punch=4", "flag.reverse=true", "signal-speed=Low", "UserOffset=-12", "MaximumPulseLimit=0x2AF8"} {
+		if err := ee.Apply(assignment); err != nil {
+			t.Fatalf("%s: %+v", assignment, err)
+		}
+	}
+	if ee.Punch != 4 || !ee.Flag.Reverse || ee.SignalSpeed != Low || ee.UserOffset != -12 || ee.MaximumPulseLimit != 11000 {
+		t.Errorf("fields are not set, actual %+v", ee)
+	}
+	for name, want := range map[string]string{"Punch": "4", "Flag.Reverse": "true", "SignalSpeed": "Low", "user-offset": "-12"} {
+		got, err := ee.Get(name)
+		if err != nil {
+			t.Fatalf("%s: %+v", name, err)
+		}
+		if got != want {
+			t.Errorf("%s should be %s, but actual %s", name, want, got)
+		}
+	}
+
+	before := ee
+	for _, assignment := range []string{"Punch=11", "StretchGain=3", "SignalSpeed=Fast", "Flag.Reverse=maybe", "Speed=-1", "Punch"} {
+		if err := ee.Apply(assignment); err == nil {
+			t.Errorf("%s: this should be fail", assignment)
+		}
+	}
+	if ee != before {
+		t.Error("illegal values should not change EEPROM")
+	}
+	if err := ee.Set("Stretch", "2"); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("unknown field should be rejected, actual: %v", err)
+	}
+}
@@ -0,0 +1,340 @@
+package eeprom
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnknownLayout is when no layout signature matches the data
+var ErrUnknownLayout = errors.New("The data doesn't match any known EEPROM layout")
+
+// ErrAmbiguousLayout is when more than one layout signature matches the data
+var ErrAmbiguousLayout = errors.New("The data matches more than one EEPROM layout")
+
+//go:embed layouts/*.json
+var layoutFiles embed.FS
+
+// layouts are sorted by version, newest first
+var layouts = mustLoadLayouts()
+
+// Layout is the EEPROM map of one servo firmware generation
+type Layout struct {
+	Name      string        `json:"name"`
+	Version   int           `json:"version"`
+	Signature []Signature   `json:"signature"`
+	Reserved  []Interval    `json:"reserved"`
+	Fields    []FieldLayout `json:"fields"`
+	// Note says what the signature can't tell apart, it is shown with every inspection
+	Note string `json:"note,omitempty"`
+}
+
+// Signature is a fixed value that identifies the layout.
+// The only fixed value known for ICS 3.5 is the 0x5A header, which older
+// generations share, so a layout for another generation must add bytes
+// that tell it apart or Detect rejects the data as ambiguous
+type Signature struct {
+	Name  string `json:"name"`
+	Start uint8  `json:"start"`
+	End   uint8  `json:"end"`
+	Value uint16 `json:"value"`
+}
+
+// FieldLayout is where a setting is stored and which values are legal,
+// Name is the same as the json name in Address and Document
+type FieldLayout struct {
+	Name  string `json:"name"`
+	Start uint8  `json:"start"`
+	End   uint8  `json:"end"`
+	Codec Codec  `json:"codec"`
+	Min   int    `json:"min,omitempty"`
+	Max   int    `json:"max,omitempty"`
+	Step  int    `json:"step,omitempty"`
+	Unit  string `json:"unit,omitempty"`
+}
+
+// Layouts returns every embedded layout, newest first
+func Layouts() []*Layout {
+	return append([]*Layout{}, layouts...)
+}
+
+// DefaultLayout is the newest embedded layout
+func DefaultLayout() *Layout {
+	return layouts[0]
+}
+
+// Detect finds the layout whose signature matches bs,
+// it never guesses when more than one layout matches.
+// A match only means the signature bytes agree, firmware of another
+// generation with the same signature is detected as this layout, see Layout.Note
+func Detect(bs []byte) (*Layout, error) {
+	return detect(layouts, bs)
+}
+
+func detect(ls []*Layout, bs []byte) (*Layout, error) {
+	if len(bs) != 64 {
+		return nil, ErrDataLength
+	}
+	var matched []*Layout
+	for _, l := range ls {
+		if l.match(bs) {
+			matched = append(matched, l)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, errors.Wrapf(ErrUnknownLayout, "origin: %v", bs)
+	case 1:
+		return matched[0], nil
+	}
+	names := make([]string, len(matched))
+	for i, l := range matched {
+		names[i] = fmt.Sprintf("%s v%d", l.Name, l.Version)
+	}
+	return nil, errors.Wrapf(ErrAmbiguousLayout, "%s, origin: %v", strings.Join(names, ", "), bs)
+}
+
+func (l *Layout) match(bs []byte) bool {
+	for _, s := range l.Signature {
+		value, err := sliceByteToUint(bs[s.Start:s.End])
+		if err != nil || value != s.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// Field finds a field by its name
+func (l *Layout) Field(name string) (FieldLayout, bool) {
+	for _, f := range l.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return FieldLayout{}, false
+}
+
+// Address returns where every field is
+func (l *Layout) Address() Address {
+	var (
+		address = Address{}
+		v       = reflect.ValueOf(&address).Elem()
+	)
+	set := func(name string, start, end uint8) {
+		if i, ok := addressIndex[name]; ok {
+			v.Field(i).Set(reflect.ValueOf(NewInterval(start, end)))
+		}
+	}
+	for _, s := range l.Signature {
+		set(s.Name, s.Start, s.End)
+	}
+	for _, f := range l.Fields {
+		set(f.Name, f.Start, f.End)
+	}
+	return address
+}
+
+// Parse resolves bs with this layout and checks every field
+func (l *Layout) Parse(bs []byte) (EEPROM, error) {
+	if len(bs) != 64 {
+		return EEPROM{}, ErrDataLength
+	}
+	if !l.match(bs) {
+		return EEPROM{}, errors.Wrapf(ErrUnknownLayout, "layout %s v%d, origin: %v", l.Name, l.Version, bs)
+	}
+	var (
+		result = EEPROM{}
+		v      = reflect.ValueOf(&result).Elem()
+	)
+	for _, f := range l.Fields {
+		value, err := codecs[f.Codec].decode(bs[f.Start:f.End])
+		if err != nil {
+			return EEPROM{}, errors.Wrapf(err, "%s, data: %v", f.Name, bs[f.Start:f.End])
+		}
+		if err := f.check(value); err != nil {
+			return EEPROM{}, err
+		}
+		field := v.Field(eepromIndex[f.Name])
+		field.Set(value.Convert(field.Type()))
+	}
+	result.Address = l.Address()
+	return result, nil
+}
+
+// Compose writes every field of target into a copy of origin,
+// bytes that are not in the layout are kept as they are
+func (l *Layout) Compose(origin []byte, target EEPROM) ([]byte, error) {
+	if len(origin) != 64 {
+		return nil, ErrDataLength
+	}
+	if !l.match(origin) {
+		return nil, errors.Wrapf(ErrUnknownLayout, "layout %s v%d, origin: %v", l.Name, l.Version, origin)
+	}
+	var (
+		result = make([]byte, len(origin))
+		v      = reflect.ValueOf(target)
+	)
+	copy(result, origin)
+	for _, f := range l.Fields {
+		value := v.Field(eepromIndex[f.Name])
+		if err := f.check(value); err != nil {
+			return nil, err
+		}
+		copy(result[f.Start:f.End], codecs[f.Codec].encode(value))
+	}
+	return result, nil
+}
+
+// Validate checks every field of e against this layout
+func (l *Layout) Validate(e EEPROM) error {
+	v := reflect.ValueOf(e)
+	for _, f := range l.Fields {
+		if err := f.check(v.Field(eepromIndex[f.Name])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check reports whether value is legal for the field
+func (f FieldLayout) check(value reflect.Value) error {
+	c := codecs[f.Codec]
+	if c.valid != nil && !c.valid(value) {
+		return errors.Wrapf(ErrDataMismatch, "%s is not legal, actual: %v", f.Name, value.Interface())
+	}
+	if !c.numeric {
+		return nil
+	}
+	var n int
+	switch value.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Int:
+		n = int(value.Int())
+	default:
+		n = int(value.Uint())
+	}
+	if n < f.Min || n > f.Max {
+		return errors.Wrapf(ErrDataMismatch, "%s should be between %d and %d, but actual is %d", f.Name, f.Min, f.Max, n)
+	}
+	if f.Step > 1 && (n-f.Min)%f.Step != 0 {
+		return errors.Wrapf(ErrDataMismatch, "%s should be a step of %d from %d, but actual is %d", f.Name, f.Step, f.Min, n)
+	}
+	return nil
+}
+
+var (
+	// eepromIndex maps a field name to the EEPROM struct field by its eeprom tag
+	eepromIndex = tagIndex(reflect.TypeOf(EEPROM{}), "eeprom")
+	// addressIndex maps a field name to the Address struct field by its json tag
+	addressIndex = tagIndex(reflect.TypeOf(Address{}), "json")
+)
+
+func tagIndex(t reflect.Type, key string) map[string]int {
+	index := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		if name := t.Field(i).Tag.Get(key); name != "" {
+			index[name] = i
+		}
+	}
+	return index
+}
+
+func mustLoadLayouts() []*Layout {
+	entries, err := layoutFiles.ReadDir("layouts")
+	if err != nil {
+		panic(err)
+	}
+	var result []*Layout
+	for _, entry := range entries {
+		dat, err := layoutFiles.ReadFile(path.Join("layouts", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		l := &Layout{}
+		if err := json.Unmarshal(dat, l); err != nil {
+			panic(errors.Wrapf(err, "layout %s", entry.Name()))
+		}
+		if err := l.verify(); err != nil {
+			panic(errors.Wrapf(err, "layout %s", entry.Name()))
+		}
+		result = append(result, l)
+	}
+	if len(result) == 0 {
+		panic("no EEPROM layout is embedded")
+	}
+	for i, a := range result {
+		for _, b := range result[i+1:] {
+			if reflect.DeepEqual(a.Signature, b.Signature) {
+				panic(errors.Errorf("layouts %s and %s have the same signature, Detect can't tell them apart", a.Name, b.Name))
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version > result[j].Version })
+	return result
+}
+
+// verify checks the layout itself, every EEPROM field must be mapped
+// exactly once and no field may overlap another
+func (l *Layout) verify() error {
+	var used [64]string
+	claim := func(name string, start, end uint8) error {
+		if start >= end || end > 64 {
+			return errors.Errorf("%s has a bad interval [%d:%d]", name, start, end)
+		}
+		for i := start; i < end; i++ {
+			if used[i] != "" {
+				return errors.Errorf("%s overlaps %s at %d", name, used[i], i)
+			}
+			used[i] = name
+		}
+		return nil
+	}
+	if len(l.Signature) == 0 {
+		return errors.New("signature is empty")
+	}
+	for _, s := range l.Signature {
+		if err := claim(s.Name, s.Start, s.End); err != nil {
+			return err
+		}
+	}
+	for _, r := range l.Reserved {
+		if err := claim("reserved", r.Start, r.End); err != nil {
+			return err
+		}
+	}
+	mapped := map[string]bool{}
+	for _, f := range l.Fields {
+		c, ok := codecs[f.Codec]
+		if !ok {
+			return errors.Errorf("%s has an unknown codec %q", f.Name, f.Codec)
+		}
+		if f.End-f.Start != c.size {
+			return errors.Errorf("%s is %d bytes, but codec %s needs %d", f.Name, f.End-f.Start, f.Codec, c.size)
+		}
+		i, ok := eepromIndex[f.Name]
+		if !ok {
+			return errors.Errorf("%s is not a field of EEPROM", f.Name)
+		}
+		if !reflect.Zero(c.typ).Type().ConvertibleTo(reflect.TypeOf(EEPROM{}).Field(i).Type) {
+			return errors.Errorf("%s can't hold codec %s", f.Name, f.Codec)
+		}
+		if mapped[f.Name] {
+			return errors.Errorf("%s is mapped twice", f.Name)
+		}
+		mapped[f.Name] = true
+		if err := claim(f.Name, f.Start, f.End); err != nil {
+			return err
+		}
+	}
+	for name := range eepromIndex {
+		if !mapped[name] {
+			return errors.Errorf("%s is not mapped", name)
+		}
+	}
+	return nil
+}
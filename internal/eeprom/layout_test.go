@@ -0,0 +1,62 @@
+package eeprom
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLayouts(t *testing.T) {
+	for _, l := range Layouts() {
+		if err := l.verify(); err != nil {
+			t.Errorf("%s v%d: %v", l.Name, l.Version, err)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := Detect(dat)
+	if err != nil {
+		t.Fatalf("%+v\n", err)
+	}
+	if l != DefaultLayout() {
+		t.Errorf("data should be %s, but actual %s", DefaultLayout().Name, l.Name)
+	}
+
+	unknown := make([]byte, len(dat))
+	copy(unknown, dat)
+	unknown[0], unknown[1] = 0x0A, 0x05
+	if _, err := Parse(unknown); !errors.Is(err, ErrUnknownLayout) {
+		t.Errorf("unknown firmware should be rejected, actual: %v", err)
+	}
+	if _, err := Compose(unknown, EEPROM{}); !errors.Is(err, ErrUnknownLayout) {
+		t.Errorf("unknown firmware should be rejected, actual: %v", err)
+	}
+}
+
+func TestDetectAmbiguous(t *testing.T) {
+	dat, err := ioutil.ReadFile("./data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	older := *DefaultLayout()
+	older.Name, older.Version = "older", 0
+	if _, err := detect([]*Layout{DefaultLayout(), &older}, dat); !errors.Is(err, ErrAmbiguousLayout) {
+		t.Errorf("a header shared by two layouts should be rejected, actual: %v", err)
+	}
+
+	older.Signature = append([]Signature{}, older.Signature...)
+	older.Signature = append(older.Signature, Signature{Name: "generation", Start: 62, End: 64, Value: 1})
+	l, err := detect([]*Layout{DefaultLayout(), &older}, dat)
+	if err != nil {
+		t.Fatalf("%+v\n", err)
+	}
+	if l != DefaultLayout() {
+		t.Errorf("data should be %s, but actual %s", DefaultLayout().Name, l.Name)
+	}
+}
@@ -0,0 +1,222 @@
+package gait
+
+import (
+	"errors"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/kinematics"
+	"math"
+	"time"
+)
+
+// Params shape a walk, lengths are in millimetres and angles in radians
+type Params struct {
+	// StepLength is how far the body moves forward in one step
+	StepLength float64 `json:"step-length" yaml:"step-length"`
+	// StepHeight is how high the swing foot is lifted
+	StepHeight float64 `json:"step-height" yaml:"step-height"`
+	// CycleTime is two steps, one of each foot
+	CycleTime time.Duration `json:"cycle-time" yaml:"cycle-time"`
+	// Sway is how far the body leans sideways over the support foot
+	Sway float64 `json:"sway" yaml:"sway"`
+	// Turn is how much the body turns left in one step, negative turns right
+	Turn float64 `json:"turn" yaml:"turn"`
+	// Height is the height of the hip over the sole while walking, lower than a straight leg
+	Height float64 `json:"height" yaml:"height"`
+	// Steps is how many steps to take, the left foot steps first
+	Steps int `json:"steps" yaml:"steps"`
+	// Period is the time between keyframes of the generated motion
+	Period time.Duration `json:"period" yaml:"period"`
+}
+
+// DefaultParams is a short, slow and safe walk of the stock KHR-3HV
+func DefaultParams() Params {
+	return Params{
+		StepLength: 20,
+		StepHeight: 15,
+		CycleTime:  1200 * time.Millisecond,
+		Sway:       12,
+		Height:     195,
+		Steps:      6,
+		Period:     40 * time.Millisecond,
+	}
+}
+
+// Validate checks that the params can be walked
+func (p Params) Validate() error {
+	switch {
+	case p.StepLength < 0:
+		return errors.New("step length should not be negative, walk backwards by turning around")
+	case p.StepHeight < 0:
+		return errors.New("step height should not be negative")
+	case p.Sway < 0:
+		return errors.New("sway should not be negative")
+	case p.Height <= 0:
+		return errors.New("height should be positive")
+	case p.Steps < 1:
+		return errors.New("there should be at least one step")
+	case p.Period <= 0 || p.CycleTime < 4*p.Period:
+		return fmt.Errorf("cycle time %v should be at least 4 periods of %v", p.CycleTime, p.Period)
+	}
+	return nil
+}
+
+// Generator turns foot trajectories into joint positions with leg IK
+type Generator struct {
+	Model       *kinematics.Model
+	Calibration kinematics.Calibration
+}
+
+// NewGenerator is a Generator of the stock KHR-3HV
+func NewGenerator() Generator {
+	return Generator{Model: kinematics.DefaultModel(), Calibration: kinematics.DefaultCalibration()}
+}
+
+// Feet are the targets of both feet in their hip frames
+type Feet struct {
+	Left  kinematics.Transform
+	Right kinematics.Transform
+}
+
+// Duration of the walk, a half cycle to crouch, the steps and a half cycle to stand up
+func (p Params) Duration() time.Duration {
+	return time.Duration(p.Steps+2) * p.CycleTime / 2
+}
+
+// Feet is where both feet are at t in their hip frames, z is the lift over the
+// ground. The feet are side by side while the body crouches during the first half
+// cycle and stands up during the last one. In between every step moves the swing
+// foot from behind the hip to in front of it while the support foot moves back,
+// the first and the last steps are half steps so the feet start and end together.
+func (p Params) Feet(t time.Duration) Feet {
+	step := p.CycleTime / 2
+	index := int(t / step)
+	u := float64(t%step) / float64(step)
+	if index < 1 || index > p.Steps {
+		return Feet{Left: p.place(0, 0), Right: p.place(0, 0)}
+	}
+	// strides are fractions of a step, -1/2 is behind the hip and 1/2 in front of it
+	swingFrom, swingTo, supportFrom, supportTo := -0.5, 0.5, 0.5, -0.5
+	if index == 1 {
+		swingFrom, supportFrom = 0, 0
+	}
+	if index == p.Steps {
+		swingTo, supportTo = 0, 0
+	}
+	// lean over the support foot, in the hip frame the feet move the other way
+	sway := p.Sway * math.Sin(math.Pi*u)
+	leftSwings := index%2 == 1
+	if !leftSwings {
+		sway = -sway
+	}
+	swing := p.place(swingFrom+(swingTo-swingFrom)*minimumJerk(u), sway)
+	swing.P[2] = p.StepHeight * math.Sin(math.Pi*u)
+	support := p.place(supportFrom+(supportTo-supportFrom)*u, sway)
+	if leftSwings {
+		return Feet{Left: swing, Right: support}
+	}
+	return Feet{Left: support, Right: swing}
+}
+
+// place is a foot on the ground at stride, turned by the same fraction of Turn
+func (p Params) place(stride, sway float64) kinematics.Transform {
+	return kinematics.Transform{
+		R: kinematics.RPY(0, 0, stride*p.Turn),
+		P: kinematics.Vec3{stride * p.StepLength, sway, 0},
+	}
+}
+
+func minimumJerk(u float64) float64 {
+	return 10*math.Pow(u, 3) - 15*math.Pow(u, 4) + 6*math.Pow(u, 5)
+}
+
+// Walk generates the motion of a walk, the legs start and end straight
+func (g Generator) Walk(name string, p Params) (khr_3hv.Motion, error) {
+	if err := p.Validate(); err != nil {
+		return khr_3hv.Motion{}, fmt.Errorf("[Walk] %w", err)
+	}
+	standing, err := g.standingHeight()
+	if err != nil {
+		return khr_3hv.Motion{}, fmt.Errorf("[Walk] %w", err)
+	}
+	if p.Height+p.StepHeight >= standing {
+		return khr_3hv.Motion{}, fmt.Errorf("[Walk] height %.1f and step height %.1f should stay below the straight leg %.1f", p.Height, p.StepHeight, standing)
+	}
+	m := khr_3hv.Motion{Name: name, Interpolation: khr_3hv.Linear}
+	for t := time.Duration(0); ; t += p.Period {
+		if t > p.Duration() {
+			t = p.Duration()
+		}
+		pose, err := g.pose(p, t, standing)
+		if err != nil {
+			return khr_3hv.Motion{}, fmt.Errorf("[Walk] at %v: %w", t, err)
+		}
+		m.Keyframes = append(m.Keyframes, khr_3hv.Keyframe{Time: t, Pose: pose})
+		if t == p.Duration() {
+			break
+		}
+	}
+	return m, m.Validate()
+}
+
+// pose solves both legs at t, the crouch blends from the straight leg to Height
+func (g Generator) pose(p Params, t time.Duration, standing float64) (khr_3hv.Pose, error) {
+	f := p.Feet(t)
+	crouch := 1.0
+	step := p.CycleTime / 2
+	if t < step {
+		crouch = minimumJerk(float64(t) / float64(step))
+	} else if t >= p.Duration()-step {
+		crouch = 1 - minimumJerk(float64(t-(p.Duration()-step))/float64(step))
+	}
+	// a straight leg is singular for IK, it is posed directly
+	if crouch < 1e-6 {
+		angles, err := g.straight()
+		if err != nil {
+			return khr_3hv.Pose{}, err
+		}
+		return g.Calibration.Pose("", angles), nil
+	}
+	height := standing - (standing-p.Height)*crouch
+	pose := khr_3hv.Pose{Positions: map[khr_3hv.Kind]uint{}}
+	for side, target := range map[kinematics.Side]kinematics.Transform{kinematics.Left: f.Left, kinematics.Right: f.Right} {
+		target.P[2] -= height
+		leg, err := g.Model.LegIK(g.Calibration, side, target)
+		if err != nil {
+			return khr_3hv.Pose{}, err
+		}
+		for kind, position := range leg.Positions {
+			pose.Positions[kind] = position
+		}
+	}
+	return pose, nil
+}
+
+// straight is every leg joint at zero
+func (g Generator) straight() (map[khr_3hv.Kind]float64, error) {
+	angles := map[khr_3hv.Kind]float64{}
+	for _, side := range []kinematics.Side{kinematics.Left, kinematics.Right} {
+		kinds, err := g.Model.LegJoints(side)
+		if err != nil {
+			return nil, err
+		}
+		for _, kind := range kinds {
+			angles[kind] = 0
+		}
+	}
+	return angles, nil
+}
+
+// standingHeight is the hip to sole distance of a straight leg
+func (g Generator) standingHeight() (float64, error) {
+	hip, err := g.Model.Hip(kinematics.Left)
+	if err != nil {
+		return 0, err
+	}
+	name, err := g.Model.Foot(kinematics.Left)
+	if err != nil {
+		return 0, err
+	}
+	foot := g.Model.Forward(nil)[name]
+	return -hip.Inverse().Apply(foot.P)[2], nil
+}
@@ -0,0 +1,82 @@
+package gait
+
+import (
+	"kondocontrol/internal/khr_3hv"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFeet(t *testing.T) {
+	p := DefaultParams()
+	step := p.CycleTime / 2
+	if f := p.Feet(0); f.Left.P != f.Right.P {
+		t.Errorf("feet should start side by side, actual %v %v", f.Left.P, f.Right.P)
+	}
+	// the middle of the first step lifts the left foot and leans right
+	f := p.Feet(step + step/2)
+	if f.Left.P[2] != p.StepHeight || f.Right.P[2] != 0 {
+		t.Errorf("left foot should be lifted %v, actual left %v right %v", p.StepHeight, f.Left.P, f.Right.P)
+	}
+	if math.Abs(f.Left.P[1]-p.Sway) > 1e-9 {
+		t.Errorf("feet should sway %v, actual %v", p.Sway, f.Left.P[1])
+	}
+	// the end of a full step has the left foot half a step in front
+	f = p.Feet(3*step - time.Nanosecond)
+	if math.Abs(f.Left.P[0]+p.StepLength/2) > 0.01 || math.Abs(f.Right.P[0]-p.StepLength/2) > 0.01 {
+		t.Errorf("after the second step the right foot should lead, actual left %v right %v", f.Left.P, f.Right.P)
+	}
+	if f := p.Feet(p.Duration()); f.Left.P != f.Right.P {
+		t.Errorf("feet should end side by side, actual %v %v", f.Left.P, f.Right.P)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	g := NewGenerator()
+	p := DefaultParams()
+	p.Turn = 0.1
+	m, err := g.Walk("walk", p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Duration() != p.Duration() {
+		t.Errorf("duration should be %v, but actual %v", p.Duration(), m.Duration())
+	}
+	for _, k := range []khr_3hv.Keyframe{m.Keyframes[0], m.Keyframes[len(m.Keyframes)-1]} {
+		for kind, position := range k.Pose.Positions {
+			if position != 7500 {
+				t.Errorf("at %v %s should be straight, actual %d", k.Time, kind, position)
+			}
+		}
+	}
+	// no joint jumps between keyframes
+	for i := 1; i < len(m.Keyframes); i++ {
+		for kind, position := range m.Keyframes[i].Pose.Positions {
+			if d := math.Abs(float64(position) - float64(m.Keyframes[i-1].Pose.Positions[kind])); d > 200 {
+				t.Errorf("%s jumps %v at %v", kind, d, m.Keyframes[i].Time)
+			}
+		}
+	}
+	// the lifted foot is really lifted
+	frames := g.Model.ForwardPose(g.Calibration, m.At(p.CycleTime*3/4))
+	if lift := frames["LeftFoot"].P[2] - frames["RightFoot"].P[2]; math.Abs(lift-p.StepHeight) > 1 {
+		t.Errorf("left foot should be %v over the right one, actual %v", p.StepHeight, lift)
+	}
+}
+
+func TestWalkValidate(t *testing.T) {
+	g := NewGenerator()
+	for name, change := range map[string]func(*Params){
+		"steps":  func(p *Params) { p.Steps = 0 },
+		"period": func(p *Params) { p.Period = p.CycleTime },
+		"height": func(p *Params) { p.Height = 230 },
+		"length": func(p *Params) { p.StepLength = -1 },
+		"reach":  func(p *Params) { p.StepLength = 400 },
+	} {
+		p := DefaultParams()
+		change(&p)
+		if _, err := g.Walk(name, p); err == nil {
+			t.Errorf("%s: Walk should fail", name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package khr_3hv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/eeprom"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	backupManifest   = "manifest.json"
+	backupTimeLayout = "20060102-150405"
+)
+
+// BackupEntry is one servo EEPROM image in a Backup
+type BackupEntry struct {
+	Kind   Kind   `json:"kind"`
+	ID     uint8  `json:"id"`
+	File   string `json:"file"`
+	SHA256 string `json:"sha256"`
+}
+
+// Backup is a snapshot of every servo EEPROM, saved as a directory
+// holding one raw image per joint and a manifest with their checksums
+type Backup struct {
+	Dir     string        `json:"-"`
+	Time    time.Time     `json:"time"`
+	Entries []BackupEntry `json:"entries"`
+}
+
+// RestorePlan is what restoring one joint would change
+type RestorePlan struct {
+	Kind    Kind
+	ID      uint8
+	Current []byte
+	Target  []byte
+	Changes []eeprom.Change
+}
+
+// Pending reports whether restoring would write the servo, any byte of the image
+// counts, so reserved bytes that differ are restored even without field Changes
+func (p RestorePlan) Pending() bool {
+	return !bytes.Equal(p.Current, p.Target)
+}
+
+// Backup reads every servo EEPROM into a new timestamped directory under root
+func (r *RobotNum) Backup(root string) (Backup, error) {
+	b := Backup{Time: time.Now()}
+	b.Dir = filepath.Join(root, b.Time.Format(backupTimeLayout))
+	if err := os.MkdirAll(b.Dir, 0755); err != nil {
+		return Backup{}, err
+	}
+	for _, kind := range r.Kinds() {
+		data, err := r[kind].ReadEEPROM()
+		if err != nil {
+			return Backup{}, fmt.Errorf("[Backup] kind %d, id %d: %w", kind, r[kind].GetID(), err)
+		}
+		entry := BackupEntry{
+			Kind:   kind,
+			ID:     r[kind].GetID(),
+			File:   fmt.Sprintf("kind%02d-id%02d.bin", kind, r[kind].GetID()),
+			SHA256: checksum(data),
+		}
+		if err := ioutil.WriteFile(filepath.Join(b.Dir, entry.File), data, 0644); err != nil {
+			return Backup{}, err
+		}
+		b.Entries = append(b.Entries, entry)
+	}
+	manifest, err := json.MarshalIndent(b, "", "    ")
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(b.Dir, backupManifest), manifest, 0644); err != nil {
+		return Backup{}, err
+	}
+	return b, nil
+}
+
+// OpenBackup loads the manifest of a backup directory
+func OpenBackup(dir string) (Backup, error) {
+	b := Backup{Dir: dir}
+	manifest, err := ioutil.ReadFile(filepath.Join(dir, backupManifest))
+	if err != nil {
+		return Backup{}, err
+	}
+	if err := json.Unmarshal(manifest, &b); err != nil {
+		return Backup{}, fmt.Errorf("[OpenBackup] %w", err)
+	}
+	return b, nil
+}
+
+// Image returns the EEPROM image of kind after checking its checksum
+func (b Backup) Image(kind Kind) ([]byte, error) {
+	for _, entry := range b.Entries {
+		if entry.Kind != kind {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(b.Dir, entry.File))
+		if err != nil {
+			return nil, err
+		}
+		if sum := checksum(data); sum != entry.SHA256 {
+			return nil, fmt.Errorf("[Backup] %s checksum mismatch, manifest: %s, actual: %s", entry.File, entry.SHA256, sum)
+		}
+		if _, err := eeprom.Parse(data); err != nil {
+			return nil, fmt.Errorf("[Backup] %s: %w", entry.File, err)
+		}
+		return data, nil
+	}
+	return nil, fmt.Errorf("[Backup] kind %d is not in %s", kind, b.Dir)
+}
+
+// PreviewRestore compares the backup with the servos of kinds,
+// all joints are used when kinds is empty. Nothing is written.
+func (r *RobotNum) PreviewRestore(b Backup, kinds []Kind) ([]RestorePlan, error) {
+	if len(kinds) == 0 {
+		for _, entry := range b.Entries {
+			kinds = append(kinds, entry.Kind)
+		}
+	}
+	plans := make([]RestorePlan, 0, len(kinds))
+	for _, kind := range kinds {
+		if int(kind) >= len(r) {
+			return nil, fmt.Errorf("[PreviewRestore] kind %d is out of range", kind)
+		}
+		target, err := b.Image(kind)
+		if err != nil {
+			return nil, err
+		}
+		current, err := r[kind].ReadEEPROM()
+		if err != nil {
+			return nil, fmt.Errorf("[PreviewRestore] kind %d: %w", kind, err)
+		}
+		before, err := eeprom.Parse(current)
+		if err != nil {
+			return nil, fmt.Errorf("[PreviewRestore] kind %d current EEPROM: %w", kind, err)
+		}
+		after, err := eeprom.Parse(target)
+		if err != nil {
+			return nil, fmt.Errorf("[PreviewRestore] kind %d backup: %w", kind, err)
+		}
+		plans = append(plans, RestorePlan{
+			Kind:    kind,
+			ID:      r[kind].GetID(),
+			Current: current,
+			Target:  target,
+			Changes: eeprom.Diff(before, after),
+		})
+	}
+	return plans, nil
+}
+
+// Restore writes the planned images and reads every one back to verify it
+func (r *RobotNum) Restore(plans []RestorePlan) error {
+	for _, plan := range plans {
+		if !plan.Pending() {
+			continue
+		}
+		target, err := eeprom.Parse(plan.Target)
+		if err != nil {
+			return fmt.Errorf("[Restore] kind %d backup: %w", plan.Kind, err)
+		}
+		if err := r[plan.Kind].writeAndVerify(plan.Target, target.ID); err != nil {
+			return fmt.Errorf("[Restore] kind %d: %w", plan.Kind, err)
+		}
+	}
+	return nil
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
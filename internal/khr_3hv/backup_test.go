@@ -0,0 +1,96 @@
+package khr_3hv
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestBackupRestore(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	b, err := r.Backup(t.TempDir())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(b.Entries) != len(r) {
+		t.Fatalf("backup should have %d entries, but actual %d", len(r), len(b.Entries))
+	}
+	opened, err := OpenBackup(b.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change the punch of LeftKnee on the servo
+	knee := left.servos[r[LeftKnee].GetID()]
+	knee.eeprom[7] = 0x05
+
+	plans, err := r.PreviewRestore(opened, []Kind{LeftKnee, Head})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(plans[0].Changes) != 1 || plans[0].Changes[0].Field != "Punch" {
+		t.Errorf("LeftKnee should only change Punch, actual %v", plans[0].Changes)
+	}
+	if len(plans[1].Changes) != 0 || plans[1].Pending() {
+		t.Errorf("Head should not change, actual %v", plans[1].Changes)
+	}
+	writes := left.writes
+	if err := r.Restore(plans); err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if left.writes != writes+1 {
+		t.Errorf("only LeftKnee should be written, writes: %d", left.writes-writes)
+	}
+	if knee.eeprom[7] != 0 {
+		t.Errorf("LeftKnee punch should be restored, actual %X", knee.eeprom[7])
+	}
+}
+
+func TestRestoreReserved(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	b, err := r.Backup(t.TempDir())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	// a reserved byte is not a field, but it differs from the backup
+	knee := left.servos[r[LeftKnee].GetID()]
+	knee.eeprom[24] ^= 0x01
+	plans, err := r.PreviewRestore(b, []Kind{LeftKnee})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(plans[0].Changes) != 0 || !plans[0].Pending() {
+		t.Fatalf("LeftKnee should be pending without field changes, actual %v", plans[0].Changes)
+	}
+
+	// a corrupt target is never written
+	plans[0].Target = append([]byte{}, plans[0].Target...)
+	plans[0].Target[0] = 0
+	writes := left.writes
+	if err := r.Restore(plans); err == nil {
+		t.Error("a corrupt image should not be restored")
+	}
+	if left.writes != writes {
+		t.Errorf("nothing should be written, writes: %d", left.writes-writes)
+	}
+}
+
+func TestBackupChecksum(t *testing.T) {
+	r, _, _ := newFakeRobot(t)
+	b, err := r.Backup(t.TempDir())
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	file := filepath.Join(b.Dir, b.Entries[Waist].File)
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[7] = 0x01
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Image(Waist); err == nil {
+		t.Error("This should be fail, because the image is changed after backup")
+	}
+}
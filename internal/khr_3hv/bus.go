@@ -0,0 +1,65 @@
+package khr_3hv
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Bus is one serial port shared by the servos on it, a command and its reply
+// hold the bus so that callers on different goroutines don't interleave
+type Bus struct {
+	Name string
+
+	mu       sync.Mutex
+	port     io.ReadWriteCloser
+	state    sync.Mutex
+	busy     bool
+	lastUsed time.Time
+}
+
+// NewBus wraps a serial port
+func NewBus(name string, port io.ReadWriteCloser) *Bus {
+	return &Bus{Name: name, port: port, lastUsed: time.Now()}
+}
+
+// Do runs one transaction on the port, waiting for the bus to be free,
+// the nil bus of an undescribed joint fails with ErrNotDescribed
+func (b *Bus) Do(f func(port io.ReadWriteCloser) error) error {
+	if b == nil {
+		return ErrNotDescribed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.setBusy(true)
+	defer b.setBusy(false)
+	return f(b.port)
+}
+
+func (b *Bus) setBusy(busy bool) {
+	b.state.Lock()
+	defer b.state.Unlock()
+	b.busy = busy
+	b.lastUsed = time.Now()
+}
+
+// Idle is how long the bus has had no transaction, zero while one is running
+func (b *Bus) Idle() time.Duration {
+	b.state.Lock()
+	defer b.state.Unlock()
+	if b.busy {
+		return 0
+	}
+	return time.Since(b.lastUsed)
+}
+
+// Buses lists every bus of the robot once, with the joints on it in numeric order
+func (r *RobotNum) Buses() map[*Bus][]Kind {
+	buses := map[*Bus][]Kind{}
+	for _, kind := range Kinds() {
+		if bus := r[kind].bus; bus != nil {
+			buses[bus] = append(buses[bus], kind)
+		}
+	}
+	return buses
+}
@@ -0,0 +1,142 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"kondocontrol/internal/eeprom"
+	"kondocontrol/internal/robot"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Where CalibrateZero offsets are stored
+const (
+	// CalibrateConfig stores the offset as the ZeroOffset of the robot description
+	CalibrateConfig = "config"
+	// CalibrateEEPROM stores the offset in the EEPROM UserOffset, the servo is straight at Neutral
+	CalibrateEEPROM = "eeprom"
+)
+
+// MaxZeroOffset is how far from Neutral a straight joint may be captured,
+// farther means it wasn't on the jig or the horn is off by a whole spline tooth
+const MaxZeroOffset = 500
+
+// calibrationSamples are read from a free joint, the median is captured
+const calibrationSamples = 5
+
+// calibrationSampleDelay is the wait between two samples, tests shorten it
+var calibrationSampleDelay = 20 * time.Millisecond
+
+// ZeroOffset is the calibration of one joint
+type ZeroOffset struct {
+	Kind Kind
+	ID   uint8
+	// Position is what the servo reported straight on the jig, Offset is Position-Neutral
+	Position uint
+	Offset   int
+	// Previous and Stored are the offsets of the target before and after StoreZeroOffsets
+	Previous int
+	Stored   int
+	Err      error
+}
+
+// CalibrateZero frees every joint in turn and calls align while the operator puts it on the jig,
+// then captures the median of a few reads as its straight position. A captured joint is held
+// where it is. A joint that fails is reported in its result, an error of align stops the calibration.
+func (r *RobotNum) CalibrateZero(kinds []Kind, align func(Kind) error) ([]ZeroOffset, error) {
+	results := make([]ZeroOffset, 0, len(kinds))
+	for _, kind := range kinds {
+		m := &r[kind]
+		result := ZeroOffset{Kind: kind, ID: m.GetID()}
+		if result.Err = m.SetFree(); result.Err != nil {
+			results = append(results, result)
+			continue
+		}
+		if err := align(kind); err != nil {
+			return results, fmt.Errorf("[CalibrateZero] %s: %w", kind, err)
+		}
+		result.Position, result.Err = m.straight()
+		if result.Err == nil {
+			result.Offset = int(result.Position) - int(robot.Neutral)
+			if result.Offset > MaxZeroOffset || result.Offset < -MaxZeroOffset {
+				result.Err = fmt.Errorf("offset %d is more than %d from neutral, is the joint on the jig?", result.Offset, MaxZeroOffset)
+			} else {
+				result.Err = m.SetPosition(result.Position)
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// straight is the median of a few positions of the free joint
+func (m *Motor) straight() (uint, error) {
+	positions := make([]uint, 0, calibrationSamples)
+	for i := 0; i < calibrationSamples; i++ {
+		if i > 0 {
+			time.Sleep(calibrationSampleDelay)
+		}
+		if err := m.SetFree(); err != nil {
+			return 0, err
+		}
+		positions = append(positions, m.Position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i] < positions[j] })
+	return positions[len(positions)/2], nil
+}
+
+// StoreZeroOffsets stores the offsets of the results without an error in target.
+// In the config ZeroOffset of the joint becomes the offset, save it with CopyZeroOffsets.
+// In the EEPROM the offset is added to UserOffset, verified, and ZeroOffset of the joint
+// is cleared as the servo itself is now straight at Neutral. The positions a servo
+// reports are taken to include its UserOffset.
+func (r *RobotNum) StoreZeroOffsets(results []ZeroOffset, target string) error {
+	if target != CalibrateConfig && target != CalibrateEEPROM {
+		return fmt.Errorf("[StoreZeroOffsets] target should be %s or %s, but actual %s", CalibrateConfig, CalibrateEEPROM, target)
+	}
+	var failed []string
+	for i := range results {
+		result := &results[i]
+		if result.Err != nil {
+			continue
+		}
+		m := &r[result.Kind]
+		if target == CalibrateConfig {
+			result.Previous = m.Joint.ZeroOffset
+			result.Stored = result.Offset
+			m.Joint.ZeroOffset = result.Offset
+			continue
+		}
+		_, result.Err = m.UpdateEEPROM(func(e *eeprom.EEPROM) error {
+			result.Previous = int(e.UserOffset)
+			result.Stored = result.Previous + result.Offset
+			if result.Stored > math.MaxInt8 || result.Stored < -math.MaxInt8 {
+				return fmt.Errorf("user offset %d should be within ±%d", result.Stored, math.MaxInt8)
+			}
+			e.UserOffset = int8(result.Stored)
+			return nil
+		})
+		if result.Err != nil {
+			failed = append(failed, result.Kind.String())
+			continue
+		}
+		m.Joint.ZeroOffset = 0
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("[StoreZeroOffsets] failed on joints %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// CopyZeroOffsets copies the ZeroOffset of every joint into the description, to be saved
+func (r *RobotNum) CopyZeroOffsets(desc *robot.Robot) error {
+	for i, j := range desc.Joints {
+		kind, err := ParseKind(j.Name)
+		if err != nil {
+			return err
+		}
+		desc.Joints[i].ZeroOffset = r[kind].Joint.ZeroOffset
+	}
+	return nil
+}
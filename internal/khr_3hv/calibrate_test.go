@@ -0,0 +1,99 @@
+package khr_3hv
+
+import (
+	"errors"
+	"kondocontrol/internal/eeprom"
+	"kondocontrol/internal/robot"
+	"testing"
+)
+
+func TestCalibrateZero(t *testing.T) {
+	delay := calibrationSampleDelay
+	calibrationSampleDelay = 0
+	t.Cleanup(func() { calibrationSampleDelay = delay })
+	r, left, _ := newFakeRobot(t)
+	// the operator puts the knee straight at 7540 and the elbow far off
+	jig := map[Kind]uint{LeftKnee: 7540, LeftElbowRoll: 8500}
+	var aligned []Kind
+	results, err := r.CalibrateZero([]Kind{LeftKnee, LeftElbowRoll, LeftHipPitch}, func(kind Kind) error {
+		aligned = append(aligned, kind)
+		if !left.servos[r[kind].GetID()].free {
+			t.Errorf("%s should be free while it is aligned", kind)
+		}
+		if position, ok := jig[kind]; ok {
+			left.mu.Lock()
+			left.servos[r[kind].GetID()].position = position
+			left.mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aligned) != 3 || len(results) != 3 {
+		t.Fatalf("every joint should be aligned, actual %v", aligned)
+	}
+	knee, elbow, hip := results[0], results[1], results[2]
+	if knee.Err != nil || knee.Position != 7540 || knee.Offset != 40 {
+		t.Errorf("knee should be 40 off, actual %+v", knee)
+	}
+	if left.servos[8].free || left.servos[8].position != 7540 {
+		t.Error("the knee should be held where it was captured")
+	}
+	if elbow.Err == nil {
+		t.Errorf("an elbow 1000 off should fail, actual %+v", elbow)
+	}
+	if hip.Err != nil || hip.Offset != 0 {
+		t.Errorf("hip should be straight, actual %+v", hip)
+	}
+
+	if err := r.StoreZeroOffsets(results, CalibrateConfig); err != nil {
+		t.Fatal(err)
+	}
+	if r[LeftKnee].Joint.ZeroOffset != 40 || r[LeftElbowRoll].Joint.ZeroOffset != 0 {
+		t.Errorf("only the knee should be offset, actual %d and %d", r[LeftKnee].Joint.ZeroOffset, r[LeftElbowRoll].Joint.ZeroOffset)
+	}
+	desc := DefaultDescription()
+	if err := r.CopyZeroOffsets(desc); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := desc.Joint("LeftKnee"); j.ZeroOffset != 40 {
+		t.Errorf("description should have the knee offset, actual %d", j.ZeroOffset)
+	}
+
+	stop := errors.New("stop")
+	if _, err := r.CalibrateZero([]Kind{Head}, func(Kind) error { return stop }); !errors.Is(err, stop) {
+		t.Errorf("an align error should stop the calibration, actual %v", err)
+	}
+}
+
+func TestStoreZeroOffsetsEEPROM(t *testing.T) {
+	r, _, _ := newFakeRobot(t)
+	r[LeftKnee].Joint.ZeroOffset = 40
+	results := []ZeroOffset{
+		{Kind: LeftKnee, Position: robot.Neutral + 40, Offset: 40},
+		{Kind: LeftHipPitch, Position: robot.Neutral + 40, Offset: 40},
+	}
+	if _, err := r[LeftHipPitch].UpdateEEPROM(func(e *eeprom.EEPROM) error { e.UserOffset = 100; return nil }); err != nil {
+		t.Fatal(err)
+	}
+	err := r.StoreZeroOffsets(results, CalibrateEEPROM)
+	if err == nil {
+		t.Error("a user offset past 127 should fail")
+	}
+	if results[0].Err != nil || results[0].Stored != results[0].Previous+40 {
+		t.Errorf("knee user offset should grow by 40, actual %+v", results[0])
+	}
+	if _, err := r[LeftKnee].ReadEEPROM(); err != nil || int(r[LeftKnee].EEPROM.UserOffset) != results[0].Stored {
+		t.Errorf("knee EEPROM should hold the offset, actual %d %v", r[LeftKnee].EEPROM.UserOffset, err)
+	}
+	if r[LeftKnee].Joint.ZeroOffset != 0 {
+		t.Error("the servo is straight at neutral now, the config offset should be cleared")
+	}
+	if results[1].Err == nil || r[LeftHipPitch].Joint.ZeroOffset != 0 {
+		t.Errorf("hip should fail, actual %+v", results[1])
+	}
+	if err := r.StoreZeroOffsets(nil, "somewhere"); err == nil {
+		t.Error("an unknown target should fail")
+	}
+}
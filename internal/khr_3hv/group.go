@@ -0,0 +1,47 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// groups are sets of joints that tools can address by name
+var groups = map[string][]Kind{
+	"head":      {Head},
+	"waist":     {Waist},
+	"left-arm":  kindRange(LeftShoulderPitch, LeftElbowRoll),
+	"right-arm": kindRange(RightShoulderPitch, RightElbowRoll),
+	"arms":      append(kindRange(LeftShoulderPitch, LeftElbowRoll), kindRange(RightShoulderPitch, RightElbowRoll)...),
+	"left-leg":  kindRange(LeftHipPitch, LeftAnkleRoll),
+	"right-leg": kindRange(RightHipPitch, RightAnkleRoll),
+	"legs":      append(kindRange(LeftHipPitch, LeftAnkleRoll), kindRange(RightHipPitch, RightAnkleRoll)...),
+	"all":       kindRange(Head, RightAnkleRoll),
+}
+
+func kindRange(from, to Kind) []Kind {
+	var kinds []Kind
+	for k := from; k <= to; k++ {
+		kinds = append(kinds, k)
+	}
+	return kinds
+}
+
+// Group returns the joints of a group
+func Group(name string) ([]Kind, error) {
+	kinds, ok := groups[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown group %q, should be one of %s", name, strings.Join(GroupNames(), ", "))
+	}
+	return append([]Kind{}, kinds...), nil
+}
+
+// GroupNames lists every group
+func GroupNames() []string {
+	var names []string
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
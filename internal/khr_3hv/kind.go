@@ -0,0 +1,175 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the stable number of a joint, it indexes RobotNum
+type Kind uint8
+
+const (
+	Head Kind = iota
+	Waist
+	LeftShoulderPitch
+	LeftShoulderRoll
+	LeftElbowYaw
+	LeftElbowRoll
+	LeftHipPitch
+	LeftHipRoll
+	LeftHipYaw
+	LeftKnee
+	LeftAnklePitch
+	LeftAnkleRoll
+	RightShoulderPitch
+	RightShoulderRoll
+	RightElbowYaw
+	RightElbowRoll
+	RightHipPitch
+	RightHipRoll
+	RightHipYaw
+	RightKnee
+	RightAnklePitch
+	RightAnkleRoll
+)
+
+// kindNames is the joint registry, the name of every Kind
+// as used by Robot, robot descriptions, id files and the API
+var kindNames = [...]string{
+	Head:               "Head",
+	Waist:              "Waist",
+	LeftShoulderPitch:  "LeftShoulderPitch",
+	LeftShoulderRoll:   "LeftShoulderRoll",
+	LeftElbowYaw:       "LeftElbowYaw",
+	LeftElbowRoll:      "LeftElbowRoll",
+	LeftHipPitch:       "LeftHipPitch",
+	LeftHipRoll:        "LeftHipRoll",
+	LeftHipYaw:         "LeftHipYaw",
+	LeftKnee:           "LeftKnee",
+	LeftAnklePitch:     "LeftAnklePitch",
+	LeftAnkleRoll:      "LeftAnkleRoll",
+	RightShoulderPitch: "RightShoulderPitch",
+	RightShoulderRoll:  "RightShoulderRoll",
+	RightElbowYaw:      "RightElbowYaw",
+	RightElbowRoll:     "RightElbowRoll",
+	RightHipPitch:      "RightHipPitch",
+	RightHipRoll:       "RightHipRoll",
+	RightHipYaw:        "RightHipYaw",
+	RightKnee:          "RightKnee",
+	RightAnklePitch:    "RightAnklePitch",
+	RightAnkleRoll:     "RightAnkleRoll",
+}
+
+// Axis is what a joint turns around
+type Axis uint8
+
+const (
+	// AxisRoll is the forward axis
+	AxisRoll Axis = iota
+	// AxisPitch is the left-right axis
+	AxisPitch
+	// AxisYaw is the vertical axis
+	AxisYaw
+)
+
+// kindMirrors is the joint on the other side of every joint,
+// Head and Waist are their own mirror
+var kindMirrors = [len(kindNames)]Kind{
+	Head:               Head,
+	Waist:              Waist,
+	LeftShoulderPitch:  RightShoulderPitch,
+	LeftShoulderRoll:   RightShoulderRoll,
+	LeftElbowYaw:       RightElbowYaw,
+	LeftElbowRoll:      RightElbowRoll,
+	LeftHipPitch:       RightHipPitch,
+	LeftHipRoll:        RightHipRoll,
+	LeftHipYaw:         RightHipYaw,
+	LeftKnee:           RightKnee,
+	LeftAnklePitch:     RightAnklePitch,
+	LeftAnkleRoll:      RightAnkleRoll,
+	RightShoulderPitch: LeftShoulderPitch,
+	RightShoulderRoll:  LeftShoulderRoll,
+	RightElbowYaw:      LeftElbowYaw,
+	RightElbowRoll:     LeftElbowRoll,
+	RightHipPitch:      LeftHipPitch,
+	RightHipRoll:       LeftHipRoll,
+	RightHipYaw:        LeftHipYaw,
+	RightKnee:          LeftKnee,
+	RightAnklePitch:    LeftAnklePitch,
+	RightAnkleRoll:     LeftAnkleRoll,
+}
+
+// kindAxes is the axis every joint turns around when the robot stands straight
+var kindAxes = [len(kindNames)]Axis{
+	Head:               AxisYaw,
+	Waist:              AxisYaw,
+	LeftShoulderPitch:  AxisPitch,
+	LeftShoulderRoll:   AxisRoll,
+	LeftElbowYaw:       AxisYaw,
+	LeftElbowRoll:      AxisRoll,
+	LeftHipPitch:       AxisPitch,
+	LeftHipRoll:        AxisRoll,
+	LeftHipYaw:         AxisYaw,
+	LeftKnee:           AxisPitch,
+	LeftAnklePitch:     AxisPitch,
+	LeftAnkleRoll:      AxisRoll,
+	RightShoulderPitch: AxisPitch,
+	RightShoulderRoll:  AxisRoll,
+	RightElbowYaw:      AxisYaw,
+	RightElbowRoll:     AxisRoll,
+	RightHipPitch:      AxisPitch,
+	RightHipRoll:       AxisRoll,
+	RightHipYaw:        AxisYaw,
+	RightKnee:          AxisPitch,
+	RightAnklePitch:    AxisPitch,
+	RightAnkleRoll:     AxisRoll,
+}
+
+// kindAliases are names older id files used for the same joints
+var kindAliases = map[string]Kind{
+	"leftelbowpitch":  LeftElbowYaw,
+	"rightelbowpitch": RightElbowYaw,
+}
+
+// String is the registry name of the joint
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return "Kind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// Valid reports whether k is a joint of the registry
+func (k Kind) Valid() bool {
+	return int(k) < len(kindNames)
+}
+
+// Kinds lists every joint in numeric order
+func Kinds() []Kind {
+	kinds := make([]Kind, len(kindNames))
+	for i := range kinds {
+		kinds[i] = Kind(i)
+	}
+	return kinds
+}
+
+// ParseKind finds a joint by its number or, case-insensitively, by its name
+func ParseKind(s string) (Kind, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 0 || n >= len(kindNames) {
+			return 0, fmt.Errorf("joint %d is out of range 0-%d", n, len(kindNames)-1)
+		}
+		return Kind(n), nil
+	}
+	for kind, name := range kindNames {
+		if strings.EqualFold(name, s) {
+			return Kind(kind), nil
+		}
+	}
+	if kind, ok := kindAliases[strings.ToLower(s)]; ok {
+		return kind, nil
+	}
+	return 0, fmt.Errorf("unknown joint %q", s)
+}
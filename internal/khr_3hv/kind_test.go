@@ -0,0 +1,64 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestKindRegistry(t *testing.T) {
+	r := Robot{}
+	for _, kind := range Kinds() {
+		byName, err := ParseKind(kind.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		byNumber, err := ParseKind(fmt.Sprint(uint8(kind)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if byName != kind || byNumber != kind {
+			t.Errorf("%s: by name %d, by number %d, should both be %d", kind, byName, byNumber, kind)
+		}
+		if lower, _ := ParseKind(strings.ToLower(kind.String())); lower != kind {
+			t.Errorf("%s should be found case-insensitively", kind)
+		}
+		if r.Motor(kind) == nil {
+			t.Errorf("Robot has no field %s", kind)
+		}
+	}
+	if kind, err := ParseKind("LeftElbowPitch"); err != nil || kind != LeftElbowYaw {
+		t.Errorf("old name LeftElbowPitch should be LeftElbowYaw, actual %s, %v", kind, err)
+	}
+	for _, s := range []string{"22", "-1", "LeftElbow", ""} {
+		if _, err := ParseKind(s); err == nil {
+			t.Errorf("%q should not be a joint", s)
+		}
+	}
+}
+
+func TestLoadIDWithYamlAgree(t *testing.T) {
+	ids := map[string]string{"LeftKnee": "12", "4": "13"}
+	r, rn := Robot{}, RobotNum{}
+	if err := r.LoadIDWithYaml(ids); err != nil {
+		t.Fatal(err)
+	}
+	if err := rn.LoadIDWithYaml(ids); err != nil {
+		t.Fatal(err)
+	}
+	if r.LeftKnee.GetID() != 12 || rn[LeftKnee].GetID() != 12 || r.LeftElbowYaw.GetID() != 13 || rn[LeftElbowYaw].GetID() != 13 {
+		t.Error("Robot and RobotNum should load the same IDs")
+	}
+	converted := rn.Robot()
+	for _, kind := range Kinds() {
+		if converted.Motor(kind).GetID() != r.Motor(kind).GetID() {
+			t.Errorf("%s: RobotNum.Robot should agree with Robot", kind)
+		}
+	}
+	if err := r.LoadIDWithYaml(map[string]string{"LeftElbow": "3"}); err == nil {
+		t.Error("an unknown joint should fail")
+	}
+	if err := r.LoadIDWithYaml(map[string]string{"Head": "32"}); err == nil {
+		t.Error("an id larger than 31 should fail")
+	}
+}
@@ -0,0 +1,119 @@
+package khr_3hv
+
+import (
+	"errors"
+	"fmt"
+	"kondocontrol/internal/robot"
+)
+
+// ErrEmptyLimits is when the EEPROM pulse limits and the described limits of a joint don't overlap
+var ErrEmptyLimits = errors.New("EEPROM and described limits don't overlap")
+
+// LimitViolation is a position command outside the soft limits of a joint,
+// in clamp mode Position is what was sent instead of Target
+type LimitViolation struct {
+	Joint    string
+	ID       uint8
+	Target   uint
+	Min      uint
+	Max      uint
+	Clamped  bool
+	Position uint
+}
+
+func (v *LimitViolation) Error() string {
+	if v.Clamped {
+		return fmt.Sprintf("joint %s (id %d) target %d is outside %d-%d, clamped to %d", v.Joint, v.ID, v.Target, v.Min, v.Max, v.Position)
+	}
+	return fmt.Sprintf("joint %s (id %d) target %d is outside %d-%d, rejected", v.Joint, v.ID, v.Target, v.Min, v.Max)
+}
+
+// Limits is the soft range of the joint, the servo range tightened by the
+// EEPROM pulse limits once they were read and by the robot description,
+// min is above max when the two don't overlap
+func (m *Motor) Limits() (min, max uint) {
+	min, max = robot.MinimumPosition, robot.MaximumPosition
+	tighten := func(lo, hi uint) {
+		if lo > min {
+			min = lo
+		}
+		if hi != 0 && hi < max {
+			max = hi
+		}
+	}
+	if m.EEPROM.MaximumPulseLimit != 0 {
+		tighten(uint(m.EEPROM.MinimumPulseLimit), uint(m.EEPROM.MaximumPulseLimit))
+	}
+	tighten(m.Joint.Limits.Min, m.Joint.Limits.Max)
+	return min, max
+}
+
+// validLimits returns ErrEmptyLimits when no position is inside Limits
+func (m *Motor) validLimits() error {
+	if min, max := m.Limits(); min > max {
+		return fmt.Errorf("joint %s EEPROM %d-%d, described %d-%d: %w", m.Joint.Name,
+			m.EEPROM.MinimumPulseLimit, m.EEPROM.MaximumPulseLimit, m.Joint.Limits.Min, m.Joint.Limits.Max, ErrEmptyLimits)
+	}
+	return nil
+}
+
+// checkLimits returns the position to send for target,
+// every violation is passed to OnLimitViolation.
+// Nothing is sent when Limits is empty, not even in clamp mode
+func (m *Motor) checkLimits(target uint) (uint, error) {
+	if err := m.validLimits(); err != nil {
+		return 0, err
+	}
+	min, max := m.Limits()
+	if target >= min && target <= max {
+		return target, nil
+	}
+	v := &LimitViolation{Joint: m.Joint.Name, ID: m.GetID(), Target: target, Min: min, Max: max}
+	if m.Joint.Limits.Mode == robot.Clamp {
+		v.Clamped = true
+		v.Position = min
+		if target > max {
+			v.Position = max
+		}
+	}
+	if m.OnLimitViolation != nil {
+		m.OnLimitViolation(*v)
+	}
+	if !v.Clamped {
+		return 0, v
+	}
+	return v.Position, nil
+}
+
+// LoadLimits reads the EEPROM of every described joint so that its pulse limits take part in Limits,
+// a joint whose pulse limits don't overlap its described limits fails with ErrEmptyLimits
+func (r *RobotNum) LoadLimits() error {
+	for _, kind := range r.Kinds() {
+		if _, err := r[kind].ReadEEPROM(); err != nil {
+			return fmt.Errorf("[LoadLimits] %s: %w", kind, err)
+		}
+		if err := r[kind].validLimits(); err != nil {
+			return fmt.Errorf("[LoadLimits] %w", err)
+		}
+	}
+	return nil
+}
+
+// SetLimitMode changes the limit mode of every joint, robot.Clamp or robot.Reject
+func (r *RobotNum) SetLimitMode(mode string) error {
+	if mode != robot.Clamp && mode != robot.Reject {
+		return fmt.Errorf("limit mode should be %s or %s, but actual %s", robot.Reject, robot.Clamp, mode)
+	}
+	for i := range r {
+		r[i].Joint.Limits.Mode = mode
+	}
+	return nil
+}
+
+// OnLimitViolation sets the violation hook of every joint
+func (r *RobotNum) OnLimitViolation(f func(kind Kind, v LimitViolation)) {
+	for _, kind := range Kinds() {
+		kind := kind
+		r[kind].OnLimitViolation = func(v LimitViolation) { f(kind, v) }
+	}
+}
@@ -0,0 +1,81 @@
+package khr_3hv
+
+import (
+	"errors"
+	"kondocontrol/internal/eeprom"
+	"kondocontrol/internal/robot"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	if err := r.LoadLimits(); err != nil {
+		t.Fatal(err)
+	}
+	m := &r[LeftKnee]
+	m.EEPROM.MinimumPulseLimit, m.EEPROM.MaximumPulseLimit = 4000, 9000
+	m.Joint.Limits = robot.Limits{Min: 5000, Max: 10000}
+	if min, max := m.Limits(); min != 5000 || max != 9000 {
+		t.Fatalf("limits should be 5000-9000, but actual %d-%d", min, max)
+	}
+
+	var reported []LimitViolation
+	r.OnLimitViolation(func(kind Kind, v LimitViolation) {
+		if kind != LeftKnee {
+			t.Errorf("violation should be on LeftKnee, but actual %s", kind)
+		}
+		reported = append(reported, v)
+	})
+
+	err := m.SetPosition(9500)
+	var violation *LimitViolation
+	if !errors.As(err, &violation) || violation.Clamped {
+		t.Fatalf("9500 should be rejected, but actual %v", err)
+	}
+	if left.servos[8].position != 7500 {
+		t.Errorf("a rejected command should not be sent, servo at %d", left.servos[8].position)
+	}
+
+	if err := r.SetLimitMode(robot.Clamp); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.SetPosition(4500); err != nil {
+		t.Fatal(err)
+	}
+	if left.servos[8].position != 5000 {
+		t.Errorf("4500 should be clamped to 5000, servo at %d", left.servos[8].position)
+	}
+	if err := m.SetPosition(8000); err != nil || left.servos[8].position != 8000 {
+		t.Errorf("8000 is inside the limits, servo at %d, %v", left.servos[8].position, err)
+	}
+	if len(reported) != 2 || !reported[1].Clamped || reported[1].Position != 5000 {
+		t.Errorf("both violations should be reported, actual %+v", reported)
+	}
+	if err := r.SetLimitMode("ignore"); err == nil {
+		t.Error("unknown limit mode should fail")
+	}
+}
+
+func TestEmptyLimits(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	m := &r[LeftKnee]
+	m.Joint.Limits = robot.Limits{Min: 8000, Max: 11000, Mode: robot.Clamp}
+	knee := left.servos[8]
+	e, err := eeprom.Parse(knee.eeprom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.MinimumPulseLimit, e.MaximumPulseLimit = 3500, 7000
+	if knee.eeprom, err = eeprom.Compose(knee.eeprom, e); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.LoadLimits(); !errors.Is(err, ErrEmptyLimits) {
+		t.Fatalf("EEPROM 3500-7000 and described 8000-11000 should not overlap, actual %v", err)
+	}
+	if err := m.SetPosition(7500); !errors.Is(err, ErrEmptyLimits) {
+		t.Errorf("no command should be clamped into empty limits, actual %v", err)
+	}
+	if left.servos[8].position != 7500 || left.writes != 0 {
+		t.Errorf("nothing should be sent, servo at %d after %d writes", left.servos[8].position, left.writes)
+	}
+}
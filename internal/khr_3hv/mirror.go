@@ -0,0 +1,132 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"kondocontrol/internal/robot"
+)
+
+// Mirror reflects poses and motions across the sagittal plane: left and
+// right joints swap, pitch joints keep their angle, roll and yaw joints flip it.
+// Angles are taken from the calibration of every joint, see Joint.
+type Mirror struct {
+	joints [len(kindNames)]robot.Joint
+}
+
+// NewMirror builds a Mirror from a robot description
+func NewMirror(desc *robot.Robot) (Mirror, error) {
+	m := Mirror{}
+	described := [len(kindNames)]bool{}
+	for _, j := range desc.Joints {
+		kind, err := ParseKind(j.Name)
+		if err != nil {
+			return m, fmt.Errorf("[NewMirror] %w", err)
+		}
+		m.joints[kind] = j
+		described[kind] = true
+	}
+	for kind, ok := range described {
+		if !ok {
+			return m, fmt.Errorf("[NewMirror] joint %s is not described", Kind(kind))
+		}
+	}
+	return m, nil
+}
+
+// Mirror builds a Mirror from the joints of the robot
+func (r *RobotNum) Mirror() Mirror {
+	m := Mirror{}
+	for _, kind := range Kinds() {
+		m.joints[kind] = r[kind].Joint
+	}
+	return m
+}
+
+// Mirror is the joint on the other side, Head and Waist are their own mirror
+func (k Kind) Mirror() Kind {
+	if !k.Valid() {
+		return k
+	}
+	return kindMirrors[k]
+}
+
+// Axis is what the joint turns around
+func (k Kind) Axis() Axis {
+	return kindAxes[k]
+}
+
+// Pitch reports whether the joint turns around the left-right axis,
+// a mirrored pitch joint keeps its angle
+func (k Kind) Pitch() bool {
+	return k.Valid() && k.Axis() == AxisPitch
+}
+
+// Angle is the position of the joint from its calibrated zero, in its direction
+func Angle(j robot.Joint, position uint) int {
+	return j.Direction * (int(position) - int(robot.Neutral) - j.ZeroOffset)
+}
+
+// PositionOf is the servo position of an angle from Angle, clamped to the servo range
+func PositionOf(j robot.Joint, angle int) uint {
+	position := int(robot.Neutral) + j.ZeroOffset + j.Direction*angle
+	if position < int(robot.MinimumPosition) {
+		return robot.MinimumPosition
+	}
+	if position > int(robot.MaximumPosition) {
+		return robot.MaximumPosition
+	}
+	return uint(position)
+}
+
+// Pose mirrors every joint of p
+func (m Mirror) Pose(p Pose) Pose {
+	mirrored := Pose{Name: p.Name, Positions: make(map[Kind]uint, len(p.Positions))}
+	for kind, position := range p.Positions {
+		angle := Angle(m.joints[kind], position)
+		if !kind.Pitch() {
+			angle = -angle
+		}
+		mirrored.Positions[kind.Mirror()] = PositionOf(m.joints[kind.Mirror()], angle)
+	}
+	return mirrored
+}
+
+// Motion mirrors every keyframe
+func (m Mirror) Motion(motion Motion) Motion {
+	mirrored := motion
+	mirrored.Keyframes = make([]Keyframe, len(motion.Keyframes))
+	for i, k := range motion.Keyframes {
+		k.Pose = m.Pose(k.Pose)
+		mirrored.Keyframes[i] = k
+	}
+	return mirrored
+}
+
+// MotionFile mirrors the joints and keyframes of a file, labels and loops are kept
+func (m Mirror) MotionFile(f MotionFile) (MotionFile, error) {
+	mirrored := f
+	mirrored.Joints = make([]string, len(f.Joints))
+	for i, name := range f.Joints {
+		kind, err := ParseKind(name)
+		if err != nil {
+			return MotionFile{}, fmt.Errorf("[Mirror] %w", err)
+		}
+		mirrored.Joints[i] = kind.Mirror().String()
+	}
+	mirrored.Keyframes = make([]KeyframeEntry, len(f.Keyframes))
+	for i, k := range f.Keyframes {
+		pose := Pose{Positions: make(map[Kind]uint, len(k.Positions))}
+		for name, position := range k.Positions {
+			kind, err := ParseKind(name)
+			if err != nil {
+				return MotionFile{}, fmt.Errorf("[Mirror] %w", err)
+			}
+			pose.Positions[kind] = position
+		}
+		k.Positions = map[string]uint{}
+		for kind, position := range m.Pose(pose).Positions {
+			k.Positions[kind.String()] = position
+		}
+		mirrored.Keyframes[i] = k
+	}
+	return mirrored, nil
+}
@@ -0,0 +1,83 @@
+package khr_3hv
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKindMirror(t *testing.T) {
+	for _, kind := range Kinds() {
+		if kind.Mirror().Mirror() != kind {
+			t.Errorf("%s mirrored twice should be itself", kind)
+		}
+		if kind != Head && kind != Waist && kind.Mirror() == kind {
+			t.Errorf("%s should have a mirror", kind)
+		}
+		if kind.Axis() != kind.Mirror().Axis() {
+			t.Errorf("%s and %s should turn around the same axis", kind, kind.Mirror())
+		}
+	}
+	if LeftElbowYaw.Mirror() != RightElbowYaw || Head.Mirror() != Head {
+		t.Error("mirror pairs are wrong")
+	}
+	if !LeftKnee.Pitch() || !RightAnklePitch.Pitch() || LeftHipYaw.Pitch() || Waist.Pitch() {
+		t.Error("pitch joints are wrong")
+	}
+}
+
+func TestMirrorPose(t *testing.T) {
+	desc := DefaultDescription()
+	for i, j := range desc.Joints {
+		if j.Name == "RightKnee" {
+			desc.Joints[i].Direction, desc.Joints[i].ZeroOffset = -1, 100
+		}
+	}
+	m, err := NewMirror(desc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wave := NewPose("wave", map[Kind]uint{LeftShoulderRoll: 9000, LeftShoulderPitch: 8200, LeftKnee: 9000, Waist: 8000})
+	mirrored := m.Pose(wave)
+	want := map[Kind]uint{RightShoulderRoll: 6000, RightShoulderPitch: 8200, RightKnee: 6100, Waist: 7000}
+	if len(mirrored.Positions) != len(want) {
+		t.Fatalf("mirrored pose should have %d joints, actual %v", len(want), mirrored.Positions)
+	}
+	for kind, position := range want {
+		if mirrored.Positions[kind] != position {
+			t.Errorf("%s should be %d, but actual %d", kind, position, mirrored.Positions[kind])
+		}
+	}
+	back := m.Pose(mirrored)
+	for kind, position := range wave.Positions {
+		if back.Positions[kind] != position {
+			t.Errorf("%s mirrored twice should be %d, but actual %d", kind, position, back.Positions[kind])
+		}
+	}
+}
+
+func TestMirrorMotionFile(t *testing.T) {
+	f, err := ParseMotionFile([]byte(waveFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMirror(DefaultDescription())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mirrored, err := m.MotionFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mirrored.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(mirrored.Joints, ",") != "RightShoulderRoll,RightElbowRoll" || len(mirrored.Loops) != 1 || mirrored.Keyframes[1].Label != "up" {
+		t.Errorf("joints should be swapped and labels kept, actual %+v", mirrored)
+	}
+	if p := mirrored.Keyframes[1].Positions["RightShoulderRoll"]; p != 5000 {
+		t.Errorf("RightShoulderRoll should be 5000, but actual %d", p)
+	}
+	if f.Joints[0] != "LeftShoulderRoll" {
+		t.Error("MotionFile should not change the original")
+	}
+}
@@ -0,0 +1,384 @@
+package khr_3hv
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrJointProtected is wrapped by the errors of a pose moving a joint the monitor freed
+var ErrJointProtected = errors.New("joint is protected by the monitor")
+
+// Monitor levels, every level includes the ones before it
+const (
+	MonitorNormal  = "normal"
+	MonitorWarning = "warning"
+	// MonitorReduced is a joint whose stretch was lowered to ReducedStretch
+	MonitorReduced = "reduced"
+	// MonitorFreed is a joint that was freed, poses moving it are rejected until Reset
+	MonitorFreed = "freed"
+	// MonitorError is a joint that couldn't be read or protected
+	MonitorError = "error"
+)
+
+var monitorLevels = map[string]int{MonitorNormal: 0, MonitorWarning: 1, MonitorReduced: 2, MonitorFreed: 3}
+
+// MonitorConfig are the thresholds of Monitor in raw sensor values, like the EEPROM
+// temperature-limit and current-limit. A temperature is past its threshold when it is
+// smaller, the sensor reads less when hotter, a current when it is larger. Zero disables a threshold.
+type MonitorConfig struct {
+	// Period is how often every joint is read
+	Period time.Duration
+	// IdleGap is how long a bus should be idle before a joint on it is read,
+	// so that reads go between the commands of a motion
+	IdleGap time.Duration
+	// History is how many samples are kept per joint
+	History int
+
+	TemperatureWarn   uint8
+	TemperatureReduce uint8
+	TemperatureFree   uint8
+	// Current thresholds are compared with the magnitude of the current, whichever direction it flows
+	CurrentWarn   uint8
+	CurrentReduce uint8
+	CurrentFree   uint8
+	// ReducedStretch is the stretch of a joint past a reduce threshold
+	ReducedStretch uint8
+}
+
+// DefaultMonitorConfig reads every joint each second and acts before the factory EEPROM
+// limits of 80 for the temperature and 63 for the current stop the servo on its own
+func DefaultMonitorConfig() MonitorConfig {
+	return MonitorConfig{
+		Period:            time.Second,
+		IdleGap:           5 * time.Millisecond,
+		History:           300,
+		TemperatureWarn:   100,
+		TemperatureReduce: 92,
+		TemperatureFree:   85,
+		CurrentWarn:       30,
+		CurrentReduce:     40,
+		CurrentFree:       50,
+		ReducedStretch:    30,
+	}
+}
+
+// level is the level of a sample
+func (c MonitorConfig) level(s MonitorSample) string {
+	past := func(temperature, current uint8) bool {
+		return temperature != 0 && s.Temperature <= temperature || current != 0 && currentMagnitude(s.Current) >= current
+	}
+	switch {
+	case past(c.TemperatureFree, c.CurrentFree):
+		return MonitorFreed
+	case past(c.TemperatureReduce, c.CurrentReduce):
+		return MonitorReduced
+	case past(c.TemperatureWarn, c.CurrentWarn):
+		return MonitorWarning
+	}
+	return MonitorNormal
+}
+
+// currentMagnitude decodes the current read from a servo,
+// 0-63 flows forward and 64-127 is 64 plus the reverse current
+func currentMagnitude(raw uint8) uint8 {
+	if raw >= 64 {
+		return raw - 64
+	}
+	return raw
+}
+
+// MonitorSample is one read of a joint
+type MonitorSample struct {
+	Time        time.Time `json:"time"`
+	Temperature uint8     `json:"temperature"`
+	// Current is as read, see currentMagnitude
+	Current uint8 `json:"current"`
+}
+
+// MonitorEvent is a joint changing level
+type MonitorEvent struct {
+	Time   time.Time     `json:"time"`
+	Kind   Kind          `json:"-"`
+	Joint  string        `json:"joint"`
+	Level  string        `json:"level"`
+	Sample MonitorSample `json:"sample"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// JointStatus is the last sample and level of a joint, TemperatureTrend is the change of the
+// temperature reading per minute over the history, negative when the joint is heating up
+type JointStatus struct {
+	Joint            string        `json:"joint"`
+	Level            string        `json:"level"`
+	Last             MonitorSample `json:"last"`
+	TemperatureTrend float64       `json:"temperature-trend"`
+}
+
+// monitorEvents is how many events Events keeps
+const monitorEvents = 100
+
+// Monitor polls the current and temperature of every joint and protects hot joints,
+// see RobotNum.Monitor
+type Monitor struct {
+	robot  *RobotNum
+	config MonitorConfig
+
+	mu          sync.Mutex
+	history     map[Kind][]MonitorSample
+	levels      map[Kind]string
+	stretch     map[Kind]uint8
+	events      []MonitorEvent
+	subscribers map[chan MonitorEvent]bool
+
+	stop chan struct{}
+	once sync.Once
+	wg   sync.WaitGroup
+}
+
+// Monitor starts polling every joint, one goroutine per bus. A joint past a warn threshold
+// raises an event, past a reduce threshold its stretch is lowered and past a free threshold
+// it is freed. A joint goes back from warning by itself, reduced and freed joints stay until Reset.
+func (r *RobotNum) Monitor(config MonitorConfig) *Monitor {
+	defaults := DefaultMonitorConfig()
+	if config.Period <= 0 {
+		config.Period = defaults.Period
+	}
+	if config.History <= 0 {
+		config.History = defaults.History
+	}
+	if config.ReducedStretch == 0 {
+		config.ReducedStretch = defaults.ReducedStretch
+	}
+	mon := &Monitor{
+		robot:       r,
+		config:      config,
+		history:     map[Kind][]MonitorSample{},
+		levels:      map[Kind]string{},
+		stretch:     map[Kind]uint8{},
+		subscribers: map[chan MonitorEvent]bool{},
+		stop:        make(chan struct{}),
+	}
+	for bus, kinds := range r.Buses() {
+		mon.wg.Add(1)
+		go mon.poll(bus, kinds)
+	}
+	return mon
+}
+
+// poll reads the joints of one bus in turn, spread over Period
+func (mon *Monitor) poll(bus *Bus, kinds []Kind) {
+	defer mon.wg.Done()
+	ticker := time.NewTicker(mon.config.Period / time.Duration(len(kinds)))
+	defer ticker.Stop()
+	for i := 0; ; i = (i + 1) % len(kinds) {
+		if !mon.waitIdle(bus) {
+			return
+		}
+		mon.read(kinds[i])
+		select {
+		case <-mon.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitIdle waits for the bus to be idle for IdleGap, false when the monitor stops
+func (mon *Monitor) waitIdle(bus *Bus) bool {
+	for {
+		idle := bus.Idle()
+		if idle >= mon.config.IdleGap {
+			return true
+		}
+		wait := mon.config.IdleGap - idle
+		if idle == 0 {
+			wait = time.Millisecond
+		}
+		select {
+		case <-mon.stop:
+			return false
+		case <-time.After(wait):
+		}
+	}
+}
+
+// read samples a joint and acts on its level
+func (mon *Monitor) read(kind Kind) {
+	m := &mon.robot[kind]
+	s := MonitorSample{Time: time.Now()}
+	var err error
+	if s.Temperature, err = m.ReadTemperature(); err == nil {
+		s.Current, err = m.ReadCurrent()
+	}
+	if err != nil {
+		mon.emit(MonitorEvent{Time: s.Time, Kind: kind, Level: MonitorError, Error: err.Error()})
+		return
+	}
+
+	mon.mu.Lock()
+	history := append(mon.history[kind], s)
+	if len(history) > mon.config.History {
+		history = history[len(history)-mon.config.History:]
+	}
+	mon.history[kind] = history
+	current := mon.level(kind)
+	mon.mu.Unlock()
+
+	level := mon.config.level(s)
+	switch {
+	case monitorLevels[level] > monitorLevels[current]:
+	case level == MonitorNormal && current == MonitorWarning:
+		// a warning clears once the joint is back under the thresholds
+	default:
+		return
+	}
+	event := MonitorEvent{Time: s.Time, Kind: kind, Level: level, Sample: s}
+	if err := mon.protect(kind, level); err != nil {
+		event.Error = err.Error()
+	}
+	mon.mu.Lock()
+	mon.levels[kind] = level
+	mon.mu.Unlock()
+	mon.emit(event)
+}
+
+// protect reduces or frees a joint as its level asks
+func (mon *Monitor) protect(kind Kind, level string) error {
+	m := &mon.robot[kind]
+	switch level {
+	case MonitorReduced:
+		stretch, err := m.ReadStretch()
+		if err != nil {
+			return err
+		}
+		mon.mu.Lock()
+		if _, ok := mon.stretch[kind]; !ok {
+			mon.stretch[kind] = stretch
+		}
+		mon.mu.Unlock()
+		return m.SetStretch(mon.config.ReducedStretch)
+	case MonitorFreed:
+		return m.SetFree()
+	}
+	return nil
+}
+
+func (mon *Monitor) level(kind Kind) string {
+	if level, ok := mon.levels[kind]; ok {
+		return level
+	}
+	return MonitorNormal
+}
+
+func (mon *Monitor) emit(e MonitorEvent) {
+	e.Joint = e.Kind.String()
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	mon.events = append(mon.events, e)
+	if len(mon.events) > monitorEvents {
+		mon.events = mon.events[len(mon.events)-monitorEvents:]
+	}
+	for ch := range mon.subscribers {
+		select {
+		case ch <- e:
+		default:
+			// a slow subscriber misses events instead of stalling the monitor
+		}
+	}
+}
+
+// Subscribe receives every event from now on until cancel is called
+func (mon *Monitor) Subscribe() (events <-chan MonitorEvent, cancel func()) {
+	ch := make(chan MonitorEvent, 16)
+	mon.mu.Lock()
+	mon.subscribers[ch] = true
+	mon.mu.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			mon.mu.Lock()
+			delete(mon.subscribers, ch)
+			mon.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Events are the last events, oldest first
+func (mon *Monitor) Events() []MonitorEvent {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	return append([]MonitorEvent{}, mon.events...)
+}
+
+// History is the samples kept of a joint, oldest first
+func (mon *Monitor) History(kind Kind) []MonitorSample {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	return append([]MonitorSample{}, mon.history[kind]...)
+}
+
+// Status of every joint that was read
+func (mon *Monitor) Status() []JointStatus {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	var status []JointStatus
+	for _, kind := range Kinds() {
+		history := mon.history[kind]
+		if len(history) == 0 {
+			continue
+		}
+		s := JointStatus{Joint: kind.String(), Level: mon.level(kind), Last: history[len(history)-1]}
+		if first := history[0]; len(history) > 1 && s.Last.Time.After(first.Time) {
+			s.TemperatureTrend = (float64(s.Last.Temperature) - float64(first.Temperature)) / s.Last.Time.Sub(first.Time).Minutes()
+		}
+		status = append(status, s)
+	}
+	return status
+}
+
+// Protected tells whether the monitor freed a joint
+func (mon *Monitor) Protected(kind Kind) bool {
+	mon.mu.Lock()
+	defer mon.mu.Unlock()
+	return mon.level(kind) == MonitorFreed
+}
+
+// Check rejects poses moving a freed joint, to be given to ApplyPose or Play
+func (mon *Monitor) Check() PoseCheck {
+	return func(p Pose) error {
+		for kind := range p.Positions {
+			if mon.Protected(kind) {
+				return fmt.Errorf("%s: %w", kind, ErrJointProtected)
+			}
+		}
+		return nil
+	}
+}
+
+// Reset clears the level of a joint once it cooled down, a reduced joint gets its stretch back
+func (mon *Monitor) Reset(kind Kind) error {
+	mon.mu.Lock()
+	stretch, reduced := mon.stretch[kind]
+	delete(mon.stretch, kind)
+	delete(mon.levels, kind)
+	mon.mu.Unlock()
+	event := MonitorEvent{Time: time.Now(), Kind: kind, Level: MonitorNormal}
+	if reduced {
+		if err := mon.robot[kind].SetStretch(stretch); err != nil {
+			event.Level, event.Error = MonitorError, err.Error()
+			mon.emit(event)
+			return fmt.Errorf("[Monitor] reset %s: %w", kind, err)
+		}
+	}
+	mon.emit(event)
+	return nil
+}
+
+// Stop ends polling and waits for it, subscribers are not closed
+func (mon *Monitor) Stop() {
+	mon.once.Do(func() { close(mon.stop) })
+	mon.wg.Wait()
+}
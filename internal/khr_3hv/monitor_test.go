@@ -0,0 +1,135 @@
+package khr_3hv
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func testMonitorConfig() MonitorConfig {
+	c := DefaultMonitorConfig()
+	c.Period = 11 * time.Millisecond
+	c.IdleGap = 0
+	return c
+}
+
+// waitEvent waits for the next event of kind at level
+func waitEvent(t *testing.T, events <-chan MonitorEvent, kind Kind, level string) MonitorEvent {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e := <-events:
+			if e.Kind == kind && e.Level == level {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("%s should become %s", kind, level)
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	for _, s := range left.servos {
+		s.temperature = 110
+	}
+	left.servos[8].stretch = 60
+	mon := r.Monitor(testMonitorConfig())
+	defer mon.Stop()
+	events, cancel := mon.Subscribe()
+	defer cancel()
+
+	set := func(temperature, current uint8) {
+		left.mu.Lock()
+		left.servos[8].temperature, left.servos[8].current = temperature, current
+		left.mu.Unlock()
+	}
+	set(98, 2)
+	e := waitEvent(t, events, LeftKnee, MonitorWarning)
+	if e.Joint != "LeftKnee" || e.Sample.Temperature != 98 {
+		t.Errorf("warning should carry the sample, actual %+v", e)
+	}
+	set(110, 2)
+	waitEvent(t, events, LeftKnee, MonitorNormal)
+
+	set(110, 45)
+	waitEvent(t, events, LeftKnee, MonitorReduced)
+	left.mu.Lock()
+	if left.servos[8].stretch != 30 {
+		t.Errorf("stretch should be reduced to 30, actual %d", left.servos[8].stretch)
+	}
+	left.mu.Unlock()
+
+	set(80, 2)
+	waitEvent(t, events, LeftKnee, MonitorFreed)
+	left.mu.Lock()
+	if !left.servos[8].free {
+		t.Error("the knee should be freed")
+	}
+	left.mu.Unlock()
+	if _, err := r.ApplyPose(NewPose("", map[Kind]uint{LeftKnee: 8000}), mon.Check()); !errors.Is(err, ErrJointProtected) {
+		t.Errorf("a freed joint should not be moved, actual %v", err)
+	}
+	if _, err := r.ApplyPose(NewPose("", map[Kind]uint{LeftHipPitch: 7600}), mon.Check()); err != nil {
+		t.Errorf("other joints should still move, actual %v", err)
+	}
+
+	// cooled down, the stretch comes back
+	set(110, 2)
+	if err := mon.Reset(LeftKnee); err != nil {
+		t.Fatal(err)
+	}
+	left.mu.Lock()
+	if left.servos[8].stretch != 60 {
+		t.Errorf("stretch should be back to 60, actual %d", left.servos[8].stretch)
+	}
+	left.mu.Unlock()
+	if mon.Protected(LeftKnee) {
+		t.Error("the knee should not be protected after Reset")
+	}
+
+	var knee *JointStatus
+	status := mon.Status()
+	for i := range status {
+		if status[i].Joint == "LeftKnee" {
+			knee = &status[i]
+		}
+	}
+	if knee == nil || len(mon.History(LeftKnee)) < 4 {
+		t.Fatalf("the knee should have a history, actual %+v", status)
+	}
+	if len(mon.Events()) < 4 {
+		t.Errorf("events should be kept, actual %v", mon.Events())
+	}
+}
+
+func TestMonitorLevel(t *testing.T) {
+	config := DefaultMonitorConfig()
+	for current, want := range map[uint8]string{
+		2:       MonitorNormal,
+		45:      MonitorReduced,
+		64 + 1:  MonitorNormal,
+		64 + 35: MonitorWarning,
+		64 + 45: MonitorReduced,
+		64 + 55: MonitorFreed,
+	} {
+		if level := config.level(MonitorSample{Temperature: 110, Current: current}); level != want {
+			t.Errorf("current %d should be %s, actual %s", current, want, level)
+		}
+	}
+}
+
+func TestMonitorIdle(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	config := testMonitorConfig()
+	config.IdleGap = time.Hour
+	mon := r.Monitor(config)
+	time.Sleep(30 * time.Millisecond)
+	mon.Stop()
+	left.mu.Lock()
+	defer left.mu.Unlock()
+	if left.writes != 0 || len(mon.Status()) != 0 {
+		t.Error("a busy bus should not be polled")
+	}
+}
@@ -0,0 +1,327 @@
+package khr_3hv
+
+import (
+	"errors"
+	"fmt"
+	"kondocontrol/internal/robot"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Interpolation is how a joint moves between two keyframes
+type Interpolation string
+
+const (
+	// Linear moves at constant speed, it jerks at every keyframe
+	Linear Interpolation = "linear"
+	// Cubic is a Catmull-Rom spline, the speed is continuous through keyframes
+	Cubic Interpolation = "cubic"
+	// MinimumJerk starts and stops every segment with zero speed and acceleration
+	MinimumJerk Interpolation = "minimum-jerk"
+)
+
+// DefaultControlPeriod is how often Play sends a pose, 50 Hz
+const DefaultControlPeriod = 20 * time.Millisecond
+
+// ErrMotionStopped is returned by Player.Wait when Stop ended the motion early
+var ErrMotionStopped = errors.New("motion stopped")
+
+// Keyframe is a pose to reach at Time from the start of the motion
+type Keyframe struct {
+	Time time.Duration
+	Pose Pose
+	// Interpolation of the segment that ends at this keyframe, the one of the motion when empty
+	Interpolation Interpolation
+}
+
+// Motion is a time-stamped list of keyframes, a joint missing in
+// a keyframe is interpolated between the keyframes that have it.
+// A joint is sent its first position from the start, so one missing
+// from the first keyframe jumps there, MotionFile.Validate rejects it
+type Motion struct {
+	Name          string
+	Interpolation Interpolation
+	Keyframes     []Keyframe
+}
+
+// Validate checks that keyframes are in time order and every pose can be sent
+func (m Motion) Validate() error {
+	if len(m.Keyframes) == 0 {
+		return fmt.Errorf("motion %s has no keyframe", m.Name)
+	}
+	if !m.Interpolation.valid() {
+		return fmt.Errorf("motion %s: unknown interpolation %q", m.Name, m.Interpolation)
+	}
+	for i, k := range m.Keyframes {
+		if k.Time < 0 || (i > 0 && k.Time <= m.Keyframes[i-1].Time) {
+			return fmt.Errorf("motion %s: keyframe %d at %v should be after the previous one", m.Name, i, k.Time)
+		}
+		if k.Interpolation != "" && !k.Interpolation.valid() {
+			return fmt.Errorf("motion %s: keyframe %d: unknown interpolation %q", m.Name, i, k.Interpolation)
+		}
+		if err := k.Pose.Validate(); err != nil {
+			return fmt.Errorf("motion %s: keyframe %d: %w", m.Name, i, err)
+		}
+	}
+	return nil
+}
+
+func (i Interpolation) valid() bool {
+	return i == "" || i == Linear || i == Cubic || i == MinimumJerk
+}
+
+// Duration is the time of the last keyframe
+func (m Motion) Duration() time.Duration {
+	if len(m.Keyframes) == 0 {
+		return 0
+	}
+	return m.Keyframes[len(m.Keyframes)-1].Time
+}
+
+// Kinds lists every joint the motion moves
+func (m Motion) Kinds() []Kind {
+	seen := map[Kind]bool{}
+	for _, k := range m.Keyframes {
+		for kind := range k.Pose.Positions {
+			seen[kind] = true
+		}
+	}
+	kinds := make([]Kind, 0, len(seen))
+	for kind := range seen {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// Transition is a minimum-jerk motion from one pose to another in d
+func Transition(name string, from, to Pose, d time.Duration) Motion {
+	return Motion{
+		Name:          name,
+		Interpolation: MinimumJerk,
+		Keyframes: []Keyframe{
+			{Time: 0, Pose: from},
+			{Time: d, Pose: to},
+		},
+	}
+}
+
+// Current is the last known position of the joints, unknown ones are left out
+func (r *RobotNum) Current(kinds []Kind) Pose {
+	p := Pose{Positions: map[Kind]uint{}}
+	for _, kind := range kinds {
+		if position := r[kind].Position; position != 0 {
+			p.Positions[kind] = position
+		}
+	}
+	return p
+}
+
+// track is the keyframes of one joint
+type track struct {
+	times     []float64
+	positions []float64
+	modes     []Interpolation
+}
+
+func (m Motion) track(kind Kind) track {
+	t := track{}
+	for _, k := range m.Keyframes {
+		position, ok := k.Pose.Positions[kind]
+		if !ok {
+			continue
+		}
+		mode := k.Interpolation
+		if mode == "" {
+			mode = m.Interpolation
+		}
+		if mode == "" {
+			mode = Linear
+		}
+		t.times = append(t.times, k.Time.Seconds())
+		t.positions = append(t.positions, float64(position))
+		t.modes = append(t.modes, mode)
+	}
+	return t
+}
+
+// at is the position of the joint at now seconds,
+// it holds the first and last keyframe outside them
+func (t track) at(now float64) float64 {
+	n := len(t.times)
+	if now <= t.times[0] {
+		return t.positions[0]
+	}
+	if now >= t.times[n-1] {
+		return t.positions[n-1]
+	}
+	i := sort.SearchFloat64s(t.times, now)
+	// segment from i-1 to i
+	t0, t1 := t.times[i-1], t.times[i]
+	p0, p1 := t.positions[i-1], t.positions[i]
+	u := (now - t0) / (t1 - t0)
+	switch t.modes[i] {
+	case MinimumJerk:
+		return p0 + (p1-p0)*(10*math.Pow(u, 3)-15*math.Pow(u, 4)+6*math.Pow(u, 5))
+	case Cubic:
+		// tangents by the neighbouring keyframes, zero at both ends
+		var m0, m1 float64
+		if i-2 >= 0 {
+			m0 = (p1 - t.positions[i-2]) / (t1 - t.times[i-2])
+		}
+		if i+1 < n {
+			m1 = (t.positions[i+1] - p0) / (t.times[i+1] - t0)
+		}
+		h := t1 - t0
+		u2, u3 := u*u, u*u*u
+		return (2*u3-3*u2+1)*p0 + (u3-2*u2+u)*h*m0 + (-2*u3+3*u2)*p1 + (u3-u2)*h*m1
+	}
+	return p0 + (p1-p0)*u
+}
+
+// At is the interpolated pose at t from the start of the motion
+func (m Motion) At(t time.Duration) Pose {
+	p := Pose{Name: m.Name, Positions: map[Kind]uint{}}
+	for _, kind := range m.Kinds() {
+		position := math.Round(m.track(kind).at(t.Seconds()))
+		position = math.Max(position, float64(robot.MinimumPosition))
+		position = math.Min(position, float64(robot.MaximumPosition))
+		p.Positions[kind] = uint(position)
+	}
+	return p
+}
+
+// Player plays a motion on a robot, it is safe to control from other goroutines
+type Player struct {
+	robot  *RobotNum
+	motion Motion
+	period time.Duration
+	checks []PoseCheck
+
+	mu      sync.Mutex
+	elapsed time.Duration
+	speed   float64
+	paused  bool
+	stop    chan struct{}
+	once    sync.Once
+	done    chan struct{}
+	err     error
+}
+
+// Play starts the motion at the control period, DefaultControlPeriod when zero.
+// Every frame goes through ApplyPose, so joint limits, bus locking and checks apply.
+func (r *RobotNum) Play(m Motion, period time.Duration, checks ...PoseCheck) (*Player, error) {
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("[Play] %w", err)
+	}
+	if period <= 0 {
+		period = DefaultControlPeriod
+	}
+	p := &Player{
+		robot:  r,
+		motion: m,
+		period: period,
+		checks: checks,
+		speed:  1,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go p.run()
+	return p, nil
+}
+
+func (p *Player) run() {
+	defer close(p.done)
+	ticker := time.NewTicker(p.period)
+	defer ticker.Stop()
+	last := time.Now()
+	for {
+		elapsed, finished := p.advance(time.Since(last))
+		last = time.Now()
+		if _, err := p.robot.ApplyPose(p.motion.At(elapsed), p.checks...); err != nil {
+			p.finish(fmt.Errorf("[Play] %s at %v: %w", p.motion.Name, elapsed, err))
+			return
+		}
+		if finished {
+			return
+		}
+		select {
+		case <-p.stop:
+			p.finish(ErrMotionStopped)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// advance moves the motion clock by wall time scaled by speed
+func (p *Player) advance(wall time.Duration) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.paused {
+		p.elapsed += time.Duration(float64(wall) * p.speed)
+	}
+	if p.elapsed >= p.motion.Duration() {
+		p.elapsed = p.motion.Duration()
+		return p.elapsed, true
+	}
+	return p.elapsed, false
+}
+
+func (p *Player) finish(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.err = err
+}
+
+// Pause holds the current pose until Resume
+func (p *Player) Pause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = true
+}
+
+// Resume continues a paused motion
+func (p *Player) Resume() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.paused = false
+}
+
+// SetSpeed scales the motion time, 2 plays twice as fast
+func (p *Player) SetSpeed(speed float64) error {
+	if speed <= 0 || math.IsInf(speed, 0) || math.IsNaN(speed) {
+		return fmt.Errorf("speed should be positive, but actual %v", speed)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.speed = speed
+	return nil
+}
+
+// Stop ends the motion where it is, the joints keep the last pose
+func (p *Player) Stop() {
+	p.once.Do(func() { close(p.stop) })
+}
+
+// Elapsed is the motion time played so far
+func (p *Player) Elapsed() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.elapsed
+}
+
+// Done is closed when the motion ends
+func (p *Player) Done() <-chan struct{} {
+	return p.done
+}
+
+// Wait blocks until the motion ends, it returns ErrMotionStopped after Stop
+func (p *Player) Wait() error {
+	<-p.done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
@@ -0,0 +1,144 @@
+package khr_3hv
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func kneeMotion(mode Interpolation) Motion {
+	return Motion{
+		Name:          "squat",
+		Interpolation: mode,
+		Keyframes: []Keyframe{
+			{Time: 0, Pose: NewPose("", map[Kind]uint{LeftKnee: 7500, Head: 7500})},
+			{Time: time.Second, Pose: NewPose("", map[Kind]uint{LeftKnee: 9500})},
+			{Time: 2 * time.Second, Pose: NewPose("", map[Kind]uint{LeftKnee: 7500, Head: 8500})},
+		},
+	}
+}
+
+func TestMotionAt(t *testing.T) {
+	cases := []struct {
+		mode Interpolation
+		at   time.Duration
+		knee uint
+	}{
+		{Linear, 250 * time.Millisecond, 8000},
+		{Linear, 1500 * time.Millisecond, 8500},
+		{MinimumJerk, 250 * time.Millisecond, 7707},
+		{MinimumJerk, 500 * time.Millisecond, 8500},
+		{Cubic, 250 * time.Millisecond, 7813},
+		{Cubic, time.Second, 9500},
+	}
+	for _, c := range cases {
+		p := kneeMotion(c.mode).At(c.at)
+		if p.Positions[LeftKnee] != c.knee {
+			t.Errorf("%s at %v: knee should be %d, but actual %d", c.mode, c.at, c.knee, p.Positions[LeftKnee])
+		}
+	}
+	m := kneeMotion(Linear)
+	// Head is missing at 1s, so it moves straight from 0s to 2s
+	if head := m.At(time.Second).Positions[Head]; head != 8000 {
+		t.Errorf("head should be 8000, but actual %d", head)
+	}
+	if knee := m.At(5 * time.Second).Positions[LeftKnee]; knee != 7500 {
+		t.Errorf("after the end the last keyframe is held, actual %d", knee)
+	}
+}
+
+func TestMotionSmooth(t *testing.T) {
+	for _, mode := range []Interpolation{Cubic, MinimumJerk} {
+		m := kneeMotion(mode)
+		// speed is continuous at the middle keyframe
+		step := 10 * time.Millisecond
+		before := float64(m.At(time.Second).Positions[LeftKnee]) - float64(m.At(time.Second - step).Positions[LeftKnee])
+		after := float64(m.At(time.Second + step).Positions[LeftKnee]) - float64(m.At(time.Second).Positions[LeftKnee])
+		if math.Abs(before-after) > 2 {
+			t.Errorf("%s: speed jumps at a keyframe, %v before and %v after", mode, before, after)
+		}
+	}
+}
+
+func TestMotionValidate(t *testing.T) {
+	m := kneeMotion(Linear)
+	m.Keyframes[2].Time = time.Second
+	if err := m.Validate(); err == nil {
+		t.Error("keyframes at the same time should fail")
+	}
+	m = kneeMotion("spline")
+	if err := m.Validate(); err == nil {
+		t.Error("unknown interpolation should fail")
+	}
+	if err := (Motion{}).Validate(); err == nil {
+		t.Error("a motion without keyframes should fail")
+	}
+}
+
+func TestPlay(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	m := kneeMotion(MinimumJerk)
+	for i := range m.Keyframes {
+		m.Keyframes[i].Time /= 20
+	}
+	player, err := r.Play(m, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := player.SetSpeed(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := player.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if left.servos[0].position != 8500 || left.servos[8].position != 7500 {
+		t.Errorf("the last keyframe should be reached, head %d knee %d", left.servos[0].position, left.servos[8].position)
+	}
+	if player.SetSpeed(0) == nil {
+		t.Error("speed 0 should fail")
+	}
+}
+
+func TestPlayPauseStop(t *testing.T) {
+	r, _, _ := newFakeRobot(t)
+	player, err := r.Play(kneeMotion(Linear), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	player.Pause()
+	time.Sleep(5 * time.Millisecond)
+	paused := player.Elapsed()
+	time.Sleep(10 * time.Millisecond)
+	if player.Elapsed() != paused {
+		t.Errorf("a paused motion should not move, %v then %v", paused, player.Elapsed())
+	}
+	player.Resume()
+	time.Sleep(10 * time.Millisecond)
+	if player.Elapsed() <= paused {
+		t.Error("a resumed motion should move")
+	}
+	player.Stop()
+	player.Stop()
+	if err := player.Wait(); !errors.Is(err, ErrMotionStopped) {
+		t.Errorf("Wait should report the stop, actual %v", err)
+	}
+}
+
+func TestTransition(t *testing.T) {
+	from := NewPose("", map[Kind]uint{LeftKnee: 9000})
+	to := NewPose("", map[Kind]uint{LeftKnee: 7500})
+	m := Transition("stand", from, to, time.Second)
+	if err := m.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if p := m.At(500 * time.Millisecond).Positions[LeftKnee]; p != 8250 {
+		t.Errorf("half way should be 8250, but actual %d", p)
+	}
+	r := RobotNum{}
+	r[LeftKnee].Position = 8000
+	if current := r.Current([]Kind{LeftKnee, Head}); len(current.Positions) != 1 || current.Positions[LeftKnee] != 8000 {
+		t.Errorf("Current should only have known positions, actual %v", current.Positions)
+	}
+}
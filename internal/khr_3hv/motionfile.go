@@ -0,0 +1,330 @@
+package khr_3hv
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// MotionFileVersion is the version of the motion file format Save writes
+const MotionFileVersion = 1
+
+// MotionFile is the on-disk form of a motion, written as YAML or JSON:
+//
+//	version: 1                    # format version, 1
+//	name: wave                    # metadata, all optional but name
+//	description: wave the left arm
+//	author: someone
+//	interpolation: minimum-jerk   # linear, cubic or minimum-jerk, linear when empty
+//	joints: [LeftShoulderRoll, LeftElbowRoll]
+//	keyframes:
+//	- duration-ms: 0              # time from the previous keyframe, from the start for the first one
+//	  positions: {LeftShoulderRoll: 7500, LeftElbowRoll: 7500}
+//	- duration-ms: 400
+//	  label: up                   # optional, loops refer to it
+//	  interpolation: cubic        # optional, for the segment ending here
+//	  positions: {LeftShoulderRoll: 10000}
+//	- duration-ms: 400
+//	  label: down
+//	  positions: {LeftShoulderRoll: 9000}
+//	loops:                        # optional, play keyframes from..to count times in total
+//	- {from: up, to: down, count: 3}
+//
+// Joints are named as Kind.String, every joint in a keyframe must be in joints.
+// The first keyframe has every joint, so that none jumps when it first appears,
+// a joint missing in a later keyframe is interpolated between the keyframes that have it.
+type MotionFile struct {
+	Version       int             `json:"version" yaml:"version"`
+	Name          string          `json:"name" yaml:"name"`
+	Description   string          `json:"description,omitempty" yaml:"description,omitempty"`
+	Author        string          `json:"author,omitempty" yaml:"author,omitempty"`
+	Interpolation Interpolation   `json:"interpolation,omitempty" yaml:"interpolation,omitempty"`
+	Joints        []string        `json:"joints" yaml:"joints"`
+	Keyframes     []KeyframeEntry `json:"keyframes" yaml:"keyframes"`
+	Loops         []Loop          `json:"loops,omitempty" yaml:"loops,omitempty"`
+}
+
+// KeyframeEntry is a keyframe of MotionFile
+type KeyframeEntry struct {
+	Duration      uint            `json:"duration-ms" yaml:"duration-ms"`
+	Label         string          `json:"label,omitempty" yaml:"label,omitempty"`
+	Interpolation Interpolation   `json:"interpolation,omitempty" yaml:"interpolation,omitempty"`
+	Positions     map[string]uint `json:"positions" yaml:"positions"`
+}
+
+// Loop repeats the keyframes from one label to another, both included
+type Loop struct {
+	From  string `json:"from" yaml:"from"`
+	To    string `json:"to" yaml:"to"`
+	Count int    `json:"count" yaml:"count"`
+}
+
+// NewMotionFile converts a motion, without labels or loops
+func NewMotionFile(m Motion) MotionFile {
+	f := MotionFile{Version: MotionFileVersion, Name: m.Name, Interpolation: m.Interpolation}
+	for _, kind := range m.Kinds() {
+		f.Joints = append(f.Joints, kind.String())
+	}
+	var last time.Duration
+	for _, k := range m.Keyframes {
+		positions := make(map[string]uint, len(k.Pose.Positions))
+		for kind, position := range k.Pose.Positions {
+			positions[kind.String()] = position
+		}
+		f.Keyframes = append(f.Keyframes, KeyframeEntry{
+			Duration:      uint((k.Time - last) / time.Millisecond),
+			Interpolation: k.Interpolation,
+			Positions:     positions,
+		})
+		last = k.Time
+	}
+	return f
+}
+
+// ParseMotionFile decodes a motion file, JSON is read as YAML.
+// Unknown fields are rejected and the motion is validated.
+func ParseMotionFile(data []byte) (MotionFile, error) {
+	f := MotionFile{}
+	if err := yaml.UnmarshalStrict(data, &f); err != nil {
+		return MotionFile{}, fmt.Errorf("[ParseMotionFile] %w", err)
+	}
+	if err := f.Validate(); err != nil {
+		return MotionFile{}, fmt.Errorf("[ParseMotionFile] %w", err)
+	}
+	return f, nil
+}
+
+// LoadMotionFile reads a motion file
+func LoadMotionFile(path string) (MotionFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return MotionFile{}, err
+	}
+	f, err := ParseMotionFile(data)
+	if err != nil {
+		return MotionFile{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return f, nil
+}
+
+// Marshal encodes the file as JSON, or as YAML for any other format
+func (f MotionFile) Marshal(format string) ([]byte, error) {
+	if strings.EqualFold(format, "json") {
+		b, err := json.MarshalIndent(f, "", "    ")
+		if err != nil {
+			return nil, err
+		}
+		return append(b, '\n'), nil
+	}
+	return yaml.Marshal(f)
+}
+
+// Save validates and writes the file, as JSON when path ends in .json and YAML otherwise
+func (f MotionFile) Save(path string) error {
+	if err := f.Validate(); err != nil {
+		return fmt.Errorf("[Save] %w", err)
+	}
+	data, err := f.Marshal(strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), "."))
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Validate checks the metadata, joints, labels and loops, then the motion they expand to,
+// a joint missing from the first keyframe is an error
+func (f MotionFile) Validate() error {
+	if f.Version != MotionFileVersion {
+		return fmt.Errorf("motion %s: version should be %d, but actual %d", f.Name, MotionFileVersion, f.Version)
+	}
+	if f.Name == "" {
+		return fmt.Errorf("motion name should not be empty")
+	}
+	joints := map[Kind]bool{}
+	for _, name := range f.Joints {
+		kind, err := ParseKind(name)
+		if err != nil {
+			return fmt.Errorf("motion %s: %w", f.Name, err)
+		}
+		if joints[kind] {
+			return fmt.Errorf("motion %s: joint %s is listed twice", f.Name, kind)
+		}
+		joints[kind] = true
+	}
+	labels := map[string]int{}
+	first := map[Kind]bool{}
+	for i, k := range f.Keyframes {
+		if i > 0 && k.Duration == 0 {
+			return fmt.Errorf("motion %s: keyframe %d duration should not be 0", f.Name, i)
+		}
+		if k.Label != "" {
+			if _, ok := labels[k.Label]; ok {
+				return fmt.Errorf("motion %s: label %s is used twice", f.Name, k.Label)
+			}
+			labels[k.Label] = i
+		}
+		for name := range k.Positions {
+			kind, err := ParseKind(name)
+			if err != nil {
+				return fmt.Errorf("motion %s: keyframe %d: %w", f.Name, i, err)
+			}
+			if !joints[kind] {
+				return fmt.Errorf("motion %s: keyframe %d: joint %s is not in joints", f.Name, i, kind)
+			}
+			first[kind] = first[kind] || i == 0
+		}
+	}
+	for kind := range joints {
+		if len(f.Keyframes) > 0 && !first[kind] {
+			return fmt.Errorf("motion %s: joint %s should be in the first keyframe", f.Name, kind)
+		}
+	}
+	last := -1
+	for _, l := range f.Loops {
+		from, ok := labels[l.From]
+		if !ok {
+			return fmt.Errorf("motion %s: loop from unknown label %q", f.Name, l.From)
+		}
+		to, ok := labels[l.To]
+		if !ok {
+			return fmt.Errorf("motion %s: loop to unknown label %q", f.Name, l.To)
+		}
+		if from > to || from <= last {
+			return fmt.Errorf("motion %s: loop %s-%s should be in order and not overlap another loop", f.Name, l.From, l.To)
+		}
+		if from == 0 && f.Keyframes[0].Duration == 0 {
+			return fmt.Errorf("motion %s: loop %s-%s can't repeat a keyframe with duration 0", f.Name, l.From, l.To)
+		}
+		if l.Count < 1 {
+			return fmt.Errorf("motion %s: loop %s-%s count should be at least 1, but actual %d", f.Name, l.From, l.To, l.Count)
+		}
+		last = to
+	}
+	_, err := f.Motion()
+	return err
+}
+
+// Motion expands loops and durations into a motion for Play
+func (f MotionFile) Motion() (Motion, error) {
+	m := Motion{Name: f.Name, Interpolation: f.Interpolation}
+	var now time.Duration
+	add := func(k KeyframeEntry) error {
+		pose := Pose{Name: k.Label, Positions: make(map[Kind]uint, len(k.Positions))}
+		for name, position := range k.Positions {
+			kind, err := ParseKind(name)
+			if err != nil {
+				return err
+			}
+			pose.Positions[kind] = position
+		}
+		now += time.Duration(k.Duration) * time.Millisecond
+		m.Keyframes = append(m.Keyframes, Keyframe{Time: now, Pose: pose, Interpolation: k.Interpolation})
+		return nil
+	}
+	i := 0
+	for _, l := range f.Loops {
+		from, to := f.label(l.From), f.label(l.To)
+		for ; i < from; i++ {
+			if err := add(f.Keyframes[i]); err != nil {
+				return Motion{}, err
+			}
+		}
+		for n := 0; n < l.Count; n++ {
+			for j := from; j <= to; j++ {
+				if err := add(f.Keyframes[j]); err != nil {
+					return Motion{}, err
+				}
+			}
+		}
+		i = to + 1
+	}
+	for ; i < len(f.Keyframes); i++ {
+		if err := add(f.Keyframes[i]); err != nil {
+			return Motion{}, err
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return Motion{}, err
+	}
+	return m, nil
+}
+
+func (f MotionFile) label(name string) int {
+	for i, k := range f.Keyframes {
+		if k.Label == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ImportCSV reads a motion authored as a table, the first column is the time
+// of the row, in seconds when the header is "time" or in milliseconds when it
+// is "time-ms", every other column is a joint and holds its position.
+// An empty cell leaves the joint out of that keyframe.
+func ImportCSV(r io.Reader, name string) (MotionFile, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return MotionFile{}, fmt.Errorf("[ImportCSV] %w", err)
+	}
+	if len(rows) < 2 {
+		return MotionFile{}, fmt.Errorf("[ImportCSV] a header and at least one row are needed")
+	}
+	header := rows[0]
+	var scale float64
+	switch strings.ToLower(strings.TrimSpace(header[0])) {
+	case "time":
+		scale = 1000
+	case "time-ms":
+		scale = 1
+	default:
+		return MotionFile{}, fmt.Errorf("[ImportCSV] first column should be time or time-ms, but actual %q", header[0])
+	}
+	f := MotionFile{Version: MotionFileVersion, Name: name, Interpolation: Linear}
+	for _, column := range header[1:] {
+		kind, err := ParseKind(column)
+		if err != nil {
+			return MotionFile{}, fmt.Errorf("[ImportCSV] %w", err)
+		}
+		f.Joints = append(f.Joints, kind.String())
+	}
+	var last uint
+	for i, row := range rows[1:] {
+		line := i + 2
+		seconds, err := strconv.ParseFloat(strings.TrimSpace(row[0]), 64)
+		if err != nil || seconds < 0 {
+			return MotionFile{}, fmt.Errorf("[ImportCSV] line %d: time %q is wrong", line, row[0])
+		}
+		at := uint(math.Round(seconds * scale))
+		if i > 0 && at <= last {
+			return MotionFile{}, fmt.Errorf("[ImportCSV] line %d: time should be after the previous row", line)
+		}
+		k := KeyframeEntry{Duration: at - last, Positions: map[string]uint{}}
+		for j, cell := range row[1:] {
+			cell = strings.TrimSpace(cell)
+			if cell == "" {
+				continue
+			}
+			position, err := strconv.ParseUint(cell, 10, 16)
+			if err != nil {
+				return MotionFile{}, fmt.Errorf("[ImportCSV] line %d: %s position %q is wrong", line, f.Joints[j], cell)
+			}
+			k.Positions[f.Joints[j]] = uint(position)
+		}
+		f.Keyframes = append(f.Keyframes, k)
+		last = at
+	}
+	if err := f.Validate(); err != nil {
+		return MotionFile{}, fmt.Errorf("[ImportCSV] %w", err)
+	}
+	return f, nil
+}
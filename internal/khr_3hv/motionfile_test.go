@@ -0,0 +1,135 @@
+package khr_3hv
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const waveFile = `version: 1
+name: wave
+description: wave the left arm
+interpolation: minimum-jerk
+joints: [LeftShoulderRoll, LeftElbowRoll]
+keyframes:
+- duration-ms: 0
+  positions: {LeftShoulderRoll: 7500, LeftElbowRoll: 7500}
+- duration-ms: 400
+  label: up
+  interpolation: cubic
+  positions: {LeftShoulderRoll: 10000}
+- duration-ms: 400
+  label: down
+  positions: {LeftShoulderRoll: 9000}
+- duration-ms: 600
+  positions: {LeftShoulderRoll: 7500, LeftElbowRoll: 7500}
+loops:
+- {from: up, to: down, count: 3}
+`
+
+func TestMotionFileLoops(t *testing.T) {
+	f, err := ParseMotionFile([]byte(waveFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := f.Motion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Keyframes) != 8 {
+		t.Fatalf("up and down 3 times should give 8 keyframes, but actual %d", len(m.Keyframes))
+	}
+	if m.Duration() != 3*time.Second {
+		t.Errorf("duration should be 3s, but actual %v", m.Duration())
+	}
+	if k := m.Keyframes[3]; k.Time != 1200*time.Millisecond || k.Pose.Positions[LeftShoulderRoll] != 10000 || k.Interpolation != Cubic {
+		t.Errorf("second up is wrong, actual %+v", k)
+	}
+}
+
+func TestMotionFileRoundTrip(t *testing.T) {
+	f, err := ParseMotionFile([]byte(waveFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	for _, name := range []string{"wave.json", "wave.yaml"} {
+		path := filepath.Join(dir, name)
+		if err := f.Save(path); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadMotionFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Description != f.Description || len(got.Keyframes) != 4 || len(got.Loops) != 1 || got.Keyframes[2].Label != "down" {
+			t.Errorf("%s: round trip failed, actual %+v", name, got)
+		}
+	}
+
+	m, _ := f.Motion()
+	again, err := NewMotionFile(m).Motion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Duration() != m.Duration() || again.At(time.Second).Positions[LeftShoulderRoll] != m.At(time.Second).Positions[LeftShoulderRoll] {
+		t.Error("NewMotionFile should keep the motion")
+	}
+}
+
+func TestMotionFileValidate(t *testing.T) {
+	cases := map[string]string{
+		"version":        strings.Replace(waveFile, "version: 1", "version: 2", 1),
+		"unknown field":  strings.Replace(waveFile, "author", "writer", 1) + "writer: x\n",
+		"joint not list": strings.Replace(waveFile, "{LeftShoulderRoll: 9000}", "{LeftKnee: 9000}", 1),
+		"zero duration":  strings.Replace(waveFile, "duration-ms: 600", "duration-ms: 0", 1),
+		"label twice":    strings.Replace(waveFile, "label: down", "label: up", 1),
+		"loop label":     strings.Replace(waveFile, "to: down", "to: left", 1),
+		"loop order":     strings.Replace(waveFile, "{from: up, to: down", "{from: down, to: up", 1),
+		"loop count":     strings.Replace(waveFile, "count: 3", "count: 0", 1),
+		"position":       strings.Replace(waveFile, "9000", "12000", 1),
+		"first keyframe": strings.Replace(waveFile, "{LeftShoulderRoll: 7500, LeftElbowRoll: 7500}", "{LeftShoulderRoll: 7500}", 1),
+	}
+	for name, data := range cases {
+		if _, err := ParseMotionFile([]byte(data)); err == nil {
+			t.Errorf("%s: should fail", name)
+		}
+	}
+}
+
+func TestImportCSV(t *testing.T) {
+	table := "time,LeftKnee,RightKnee\n0,7500,7500\n0.5,8000,\n1.25,7500,7000\n"
+	f, err := ImportCSV(strings.NewReader(table), "bend")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Joints) != 2 || len(f.Keyframes) != 3 || f.Keyframes[2].Duration != 750 {
+		t.Errorf("import is wrong, actual %+v", f)
+	}
+	if _, ok := f.Keyframes[1].Positions["RightKnee"]; ok {
+		t.Error("an empty cell should leave the joint out")
+	}
+	m, err := f.Motion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := m.At(500 * time.Millisecond).Positions[RightKnee]; p != 7300 {
+		t.Errorf("RightKnee should be interpolated to 7300, but actual %d", p)
+	}
+
+	ms := "time-ms,Head\n0,7500\n200,7600\n"
+	if f, err := ImportCSV(strings.NewReader(ms), "nod"); err != nil || f.Keyframes[1].Duration != 200 {
+		t.Errorf("time-ms should be read in milliseconds, actual %+v, %v", f, err)
+	}
+	for _, bad := range []string{
+		"seconds,Head\n0,7500\n",
+		"time,Neck\n0,7500\n",
+		"time,Head\n0,7500\n0,7600\n",
+		"time,Head\n0,abc\n",
+	} {
+		if _, err := ImportCSV(strings.NewReader(bad), "bad"); err == nil {
+			t.Errorf("%q should fail", bad)
+		}
+	}
+}
@@ -3,129 +3,171 @@ package khr_3hv
 import (
 	_ "embed"
 	"errors"
+	"fmt"
 	"io"
 	"kondocontrol/internal/eeprom"
+	"kondocontrol/internal/robot"
 	"kondocontrol/internal/serial"
 	"reflect"
 	"strconv"
-
-	"gopkg.in/yaml.v2"
+	"time"
 )
 
-// Robot
+// eepromWriteDelay is how long a servo needs to store a written EEPROM
+var eepromWriteDelay = time.Second
+
+// Robot has a field per joint, named by Kind.String
 type Robot struct {
 	Head               Motor
 	Waist              Motor
-	LeftShoulderRoll   Motor
 	LeftShoulderPitch  Motor
+	LeftShoulderRoll   Motor
+	LeftElbowYaw       Motor
 	LeftElbowRoll      Motor
-	LeftElbowPitch     Motor
-	LeftHipRoll        Motor
 	LeftHipPitch       Motor
+	LeftHipRoll        Motor
 	LeftHipYaw         Motor
 	LeftKnee           Motor
-	LeftAnkleRoll      Motor
 	LeftAnklePitch     Motor
-	RightShoulderRoll  Motor
+	LeftAnkleRoll      Motor
 	RightShoulderPitch Motor
+	RightShoulderRoll  Motor
+	RightElbowYaw      Motor
 	RightElbowRoll     Motor
-	RightElbowPitch    Motor
-	RightHipRoll       Motor
 	RightHipPitch      Motor
+	RightHipRoll       Motor
 	RightHipYaw        Motor
 	RightKnee          Motor
-	RightAnkleRoll     Motor
 	RightAnklePitch    Motor
+	RightAnkleRoll     Motor
 }
 
 // RobotNum
 type RobotNum [22]Motor
 
-// Kind
-type Kind uint8
-
-const (
-	Head Kind = iota
-	Waist
-	LeftShoulderPitch
-	LeftShoulderRoll
-	LeftElbowYaw
-	LeftElbowRoll
-	LeftHipPitch
-	LeftHipRoll
-	LeftHipYaw
-	LeftKnee
-	LeftAnklePitch
-	LeftAnkleRoll
-	RightShoulderPitch
-	RightShoulderRoll
-	RightElbowYaw
-	RightElbowRoll
-	RightHipPitch
-	RightHipRoll
-	RightHipYaw
-	RightKnee
-	RightAnklePitch
-	RightAnkleRoll
-)
-
-//go:embed id.yaml
-var defaultYaml []byte
-
 // DefaultRobot
 func DefaultRobot(leftPort, rightPort io.ReadWriteCloser) (Robot, error) {
-	r := Robot{}
-	tt := make(map[string]string)
-	if err := yaml.Unmarshal(defaultYaml, &tt); err != nil {
-		return r, err
+	r, err := DefaultRobotNum(leftPort, rightPort)
+	if err != nil {
+		return Robot{}, err
 	}
-	r.LoadIDWithYaml(tt)
-	return r, nil
+	return r.Robot(), nil
 }
 
-// DefaultRobotNum
-func DefaultRobotNum(leftPort, rightPort io.ReadWriteCloser) (RobotNum, error) {
+//go:embed khr-3hv.yaml
+var defaultDescription []byte
+
+// DefaultDescription is the description of a stock KHR-3HV,
+// the left port drives the head and the left limbs, the right one the waist and the right limbs
+func DefaultDescription() *robot.Robot {
+	desc, err := robot.Load(defaultDescription)
+	if err != nil {
+		panic(err)
+	}
+	return desc
+}
+
+// ErrNotDescribed is when a joint the robot description doesn't have is driven
+var ErrNotDescribed = errors.New("joint is not described")
+
+// NewMotors connects every joint of a description whatever joints it declares,
+// by joint name. The port of each joint is looked up in ports by its name
+func NewMotors(desc *robot.Robot, ports map[string]io.ReadWriteCloser) (map[string]*Motor, error) {
+	if err := desc.Validate(); err != nil {
+		return nil, err
+	}
+	motors := make(map[string]*Motor, len(desc.Joints))
+	buses := map[string]*Bus{}
+	for _, j := range desc.Joints {
+		port, ok := ports[j.Port]
+		if !ok {
+			return nil, fmt.Errorf("joint %s is on port %s, but it isn't given", j.Name, j.Port)
+		}
+		if buses[j.Port] == nil {
+			buses[j.Port] = NewBus(j.Port, port)
+		}
+		m := &Motor{Joint: j, bus: buses[j.Port]}
+		m.SetID(j.ID)
+		motors[j.Name] = m
+	}
+	return motors, nil
+}
+
+// NewRobotNum builds RobotNum from the joints of a description that are in the
+// joint registry, a kit without some of them leaves those undescribed, see Kinds.
+// Joints outside the registry can only be driven through NewMotors
+func NewRobotNum(desc *robot.Robot, ports map[string]io.ReadWriteCloser) (RobotNum, error) {
 	r := RobotNum{}
-	// setting all ID
-	settingRobotNumID(&r)
-	// setting all port
-	r[Head].port = leftPort
-	r[Waist].port = rightPort
-	for i := LeftShoulderPitch; i <= LeftAnkleRoll; i++ {
-		r[i].port = leftPort
+	motors, err := NewMotors(desc, ports)
+	if err != nil {
+		return r, err
 	}
-	for i := RightShoulderPitch; i <= RightAnkleRoll; i++ {
-		r[i].port = rightPort
+	described := [len(kindNames)]bool{}
+	for _, j := range desc.Joints {
+		kind, err := ParseKind(j.Name)
+		if err != nil {
+			return r, fmt.Errorf("joint %s is not in the joint registry, use NewMotors", j.Name)
+		}
+		if described[kind] {
+			return r, fmt.Errorf("joint %s is described twice", kind)
+		}
+		r[kind] = *motors[j.Name]
+		described[kind] = true
 	}
 	return r, nil
 }
+
+// Kinds lists the described joints in numeric order
+func (r *RobotNum) Kinds() []Kind {
+	var kinds []Kind
+	for _, kind := range Kinds() {
+		if r[kind].bus != nil {
+			kinds = append(kinds, kind)
+		}
+	}
+	return kinds
+}
+
+// DefaultRobotNum
+func DefaultRobotNum(leftPort, rightPort io.ReadWriteCloser) (RobotNum, error) {
+	return NewRobotNum(DefaultDescription(), map[string]io.ReadWriteCloser{
+		"left":  leftPort,
+		"right": rightPort,
+	})
+}
+
+// LimitNum is the largest joint number
 func LimitNum() int {
-	return int(RightAnklePitch)
+	return len(RobotNum{}) - 1
 }
 func settingRobotNumID(r *RobotNum) {
-	r[Head].EEPROM.ID = 0
-	r[Waist].EEPROM.ID = 0
-	for i := LeftShoulderPitch; i <= LeftAnkleRoll; i++ {
-		r[i].EEPROM.ID = uint8(i-LeftShoulderPitch) + 1
-	}
-	for i := RightShoulderPitch; i <= RightAnkleRoll; i++ {
-		r[i].EEPROM.ID = uint8(i-RightShoulderPitch) + 1
+	for _, j := range DefaultDescription().Joints {
+		kind, _ := ParseKind(j.Name)
+		r[kind].SetID(j.ID)
 	}
 }
 
 type Motor struct {
+	// Joint is how the servo is described in the robot description
+	Joint       robot.Joint
 	EEPROM      eeprom.EEPROM
 	Position    uint
 	Stretch     uint8
 	Speed       uint8
 	Current     uint8
 	Temperature uint8
-	port        io.ReadWriteCloser
+	// OnLimitViolation is called with every position command outside Limits
+	OnLimitViolation func(LimitViolation)
+	bus              *Bus
 }
 
 // SetFree
 func (m *Motor) SetFree() error {
-	position, err := serial.SetFree(m.EEPROM.ID, m.port)
+	var position uint
+	err := m.bus.Do(func(port io.ReadWriteCloser) (err error) {
+		position, err = serial.SetFree(m.EEPROM.ID, port)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -133,9 +175,18 @@ func (m *Motor) SetFree() error {
 	return nil
 }
 
-// SetPosition
+// SetPosition moves the servo to target, a target outside Limits is
+// clamped or rejected with a *LimitViolation as the joint is configured
 func (m *Motor) SetPosition(target uint) error {
-	currentPos, err := serial.SetPosition(m.GetID(), target, m.port)
+	target, err := m.checkLimits(target)
+	if err != nil {
+		return err
+	}
+	var currentPos uint
+	err = m.bus.Do(func(port io.ReadWriteCloser) (err error) {
+		currentPos, err = serial.SetPosition(m.GetID(), target, port)
+		return err
+	})
 	if err != nil {
 		return err
 	}
@@ -146,7 +197,105 @@ func (m Motor) SetSpeed(speedValue uint8) ([]byte, error) {
 	if speedValue > 127 {
 		return []byte{}, errors.New("speedValue 不可超過 127")
 	}
-	return serial.WriteEEPROM(m.GetID(), serial.ScSpeed, []byte{speedValue}, m.port)
+	var result []byte
+	err := m.bus.Do(func(port io.ReadWriteCloser) (err error) {
+		result, err = serial.WriteEEPROM(m.GetID(), serial.ScSpeed, []byte{speedValue}, port)
+		return err
+	})
+	return result, err
+}
+
+// SetStretch changes the holding stiffness, 1-127
+func (m *Motor) SetStretch(stretch uint8) error {
+	if stretch == 0 || stretch > 127 {
+		return fmt.Errorf("[SetStretch] stretch %d should be 1-127", stretch)
+	}
+	err := m.bus.Do(func(port io.ReadWriteCloser) error {
+		_, err := serial.WriteEEPROM(m.GetID(), serial.ScStretch, []byte{stretch}, port)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	m.Stretch = stretch
+	return nil
+}
+
+// ReadStretch reads the stretch into m.Stretch
+func (m *Motor) ReadStretch() (uint8, error) {
+	return m.readParameter(serial.ScStretch, &m.Stretch)
+}
+
+// ReadCurrent reads the current sensor into m.Current
+func (m *Motor) ReadCurrent() (uint8, error) {
+	return m.readParameter(serial.ScCurrent, &m.Current)
+}
+
+// ReadTemperature reads the temperature sensor into m.Temperature, smaller is hotter
+func (m *Motor) ReadTemperature() (uint8, error) {
+	return m.readParameter(serial.ScTemperature, &m.Temperature)
+}
+
+func (m *Motor) readParameter(sc serial.SubCommand, field *uint8) (uint8, error) {
+	var value uint8
+	err := m.bus.Do(func(port io.ReadWriteCloser) (err error) {
+		value, err = serial.ReadParameter(m.GetID(), sc, port)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	*field = value
+	return value, nil
+}
+
+// ReadEEPROM reads the raw EEPROM image and updates m.EEPROM with it
+func (m *Motor) ReadEEPROM() ([]byte, error) {
+	var data []byte
+	err := m.bus.Do(func(port io.ReadWriteCloser) (err error) {
+		data, err = serial.ReadEEPROM(m.GetID(), serial.ScEEPROM, port)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	e, err := eeprom.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	m.EEPROM = e
+	return data, nil
+}
+
+// InspectEEPROM reads the EEPROM image without requiring it to be legal
+func (m *Motor) InspectEEPROM() (eeprom.Inspection, error) {
+	var data []byte
+	err := m.bus.Do(func(port io.ReadWriteCloser) (err error) {
+		data, err = serial.ReadRawEEPROM(m.GetID(), serial.ScEEPROM, port)
+		return err
+	})
+	if err != nil {
+		return eeprom.Inspection{}, err
+	}
+	return eeprom.Inspect(data)
+}
+
+// WriteEEPROM writes a raw EEPROM image and waits for the servo to store it
+func (m *Motor) WriteEEPROM(data []byte) error {
+	err := m.bus.Do(func(port io.ReadWriteCloser) error {
+		_, err := serial.WriteEEPROM(m.GetID(), serial.ScEEPROM, data, port)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	time.Sleep(eepromWriteDelay)
+	return nil
+}
+
+// Bus is the bus the servo is on
+func (m *Motor) Bus() *Bus {
+	return m.bus
 }
 
 // GetID
@@ -159,37 +308,60 @@ func (m *Motor) SetID(id uint8) {
 	m.EEPROM.ID = id
 }
 
-// LoadIDWithYaml
+// Motor is the field of the joint
+func (r *Robot) Motor(kind Kind) *Motor {
+	f := reflect.ValueOf(r).Elem().FieldByName(kind.String())
+	if !f.IsValid() {
+		return nil
+	}
+	return f.Addr().Interface().(*Motor)
+}
+
+// Robot copies every joint into the fields of Robot
+func (r RobotNum) Robot() Robot {
+	robot := Robot{}
+	for _, kind := range Kinds() {
+		*robot.Motor(kind) = r[kind]
+	}
+	return robot
+}
+
+// LoadIDWithYaml sets the IDs of an id file, a map from joint name or number to ID
 func (r *Robot) LoadIDWithYaml(y map[string]string) error {
-	val := reflect.Indirect(reflect.ValueOf(r))
+	ids, err := parseIDs(y)
+	if err != nil {
+		return err
+	}
+	for kind, id := range ids {
+		r.Motor(kind).SetID(id)
+	}
+	return nil
+}
+
+// LoadIDWithYaml sets the IDs of an id file, a map from joint name or number to ID
+func (r *RobotNum) LoadIDWithYaml(y map[string]string) error {
+	ids, err := parseIDs(y)
+	if err != nil {
+		return err
+	}
+	for kind, id := range ids {
+		r[kind].SetID(id)
+	}
+	return nil
+}
+
+func parseIDs(y map[string]string) (map[Kind]uint8, error) {
+	ids := make(map[Kind]uint8, len(y))
 	for key, v := range y {
-		f := val.FieldByName(key)
-		if f.IsValid() {
-			// A Value can be changed only if it is
-			// addressable and was not obtained by
-			// the use of unexported struct fields.
-			if f.CanSet() {
-				// change value of N
-				if f.Kind() == reflect.Struct {
-					if f.Type().Name() != "Motor" {
-						return errors.New("LoadYaml have Something wrong")
-					}
-					if !f.CanInterface() {
-						return errors.New("LoadYaml have Something wrong with Interface")
-					}
-					motor, ok := f.Interface().(Motor)
-					if !ok {
-						return errors.New("LoadYaml have Something wrong with Transformation")
-					}
-					i, err := strconv.Atoi(v)
-					if err != nil {
-						return err
-					}
-					motor.SetID(uint8(i))
-					f.Set(reflect.ValueOf(motor))
-				}
-			}
+		kind, err := ParseKind(key)
+		if err != nil {
+			return nil, fmt.Errorf("[LoadIDWithYaml] %w", err)
+		}
+		id, err := strconv.ParseUint(v, 10, 8)
+		if err != nil || id > 31 {
+			return nil, fmt.Errorf("[LoadIDWithYaml] %s id %q should be 0-31", kind, v)
 		}
+		ids[kind] = uint8(id)
 	}
-	return nil
+	return ids, nil
 }
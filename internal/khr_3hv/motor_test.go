@@ -2,6 +2,9 @@ package khr_3hv
 
 import (
 	_ "embed"
+	"errors"
+	"io"
+	"kondocontrol/internal/robot"
 	"testing"
 
 	"gopkg.in/yaml.v2"
@@ -44,11 +47,11 @@ func TestYaml(t *testing.T) {
 		t.Errorf("ID RightShoulderRoll is wrong, should be %d, but actual %d", id, r.RightShoulderRoll.GetID())
 	}
 	id = 3
-	if r.LeftElbowPitch.GetID() != id {
-		t.Errorf("ID RightElbowRoll is wrong, should be %d, but actual %d", id, r.RightElbowRoll.GetID())
+	if r.LeftElbowYaw.GetID() != id {
+		t.Errorf("ID LeftElbowYaw is wrong, should be %d, but actual %d", id, r.LeftElbowYaw.GetID())
 	}
-	if r.RightElbowPitch.GetID() != id {
-		t.Errorf("ID RightElbowPitch is wrong, should be %d, but actual %d", id, r.RightElbowPitch.GetID())
+	if r.RightElbowYaw.GetID() != id {
+		t.Errorf("ID RightElbowYaw is wrong, should be %d, but actual %d", id, r.RightElbowYaw.GetID())
 	}
 	id = 4
 	if r.LeftElbowRoll.GetID() != id {
@@ -185,3 +188,64 @@ func TestDefaultRobotNum(t *testing.T) {
 		t.Errorf("ID RightAnkleRoll is wrong, should be %d, but actual %d", id, r[RightAnkleRoll].GetID())
 	}
 }
+
+func TestNewRobotNum(t *testing.T) {
+	desc := DefaultDescription()
+	if len(desc.Joints) != LimitNum()+1 {
+		t.Fatalf("default description should have %d joints, but actual %d", LimitNum()+1, len(desc.Joints))
+	}
+	left, right := newFakePort(t), newFakePort(t)
+	r, err := NewRobotNum(desc, map[string]io.ReadWriteCloser{"left": left, "right": right})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r[Waist].bus.port != right || r[LeftKnee].bus.port != left || r[Head].bus != r[LeftKnee].bus || r[LeftKnee].GetID() != 8 {
+		t.Error("joints should be placed as described")
+	}
+	if _, err := NewRobotNum(desc, map[string]io.ReadWriteCloser{"left": left}); err == nil {
+		t.Error("a missing port should fail")
+	}
+	desc.Joints[0].Model = "KRS-788HV"
+	if _, err := NewRobotNum(desc, map[string]io.ReadWriteCloser{"left": left, "right": right}); err == nil {
+		t.Error("an unknown servo model should fail")
+	}
+	desc.Joints[0].Name = "1"
+	desc.Joints[0].Model = "KRS-2552RHV"
+	if _, err := NewRobotNum(desc, map[string]io.ReadWriteCloser{"left": left, "right": right}); err == nil {
+		t.Error("a joint described twice should fail")
+	}
+
+	// a kit without a head
+	desc.Joints = desc.Joints[1:]
+	r, err = NewRobotNum(desc, map[string]io.ReadWriteCloser{"left": left, "right": right})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kinds := r.Kinds(); len(kinds) != LimitNum() || kinds[0] != Waist {
+		t.Errorf("every joint but Head should be described, actual %v", kinds)
+	}
+	if err := r[Head].SetPosition(7500); !errors.Is(err, ErrNotDescribed) {
+		t.Errorf("an undescribed joint should not be driven, actual %v", err)
+	}
+}
+
+func TestNewMotors(t *testing.T) {
+	desc := &robot.Robot{Name: "arm", Joints: []robot.Joint{
+		{Name: "Shoulder", Port: "arm", ID: 1, Model: "KRS-2552RHV", Direction: 1},
+		{Name: "Wrist", Port: "arm", ID: 2, Model: "KRS-2552RHV", Direction: -1},
+	}}
+	arm := newFakePort(t, 1, 2)
+	motors, err := NewMotors(desc, map[string]io.ReadWriteCloser{"arm": arm})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := motors["Wrist"].SetPosition(8000); err != nil {
+		t.Fatal(err)
+	}
+	if arm.servos[2].position != 8000 || motors["Shoulder"].Bus() != motors["Wrist"].Bus() {
+		t.Errorf("Wrist should be driven on the arm bus, servo at %d", arm.servos[2].position)
+	}
+	if _, err := NewRobotNum(desc, map[string]io.ReadWriteCloser{"arm": arm}); err == nil {
+		t.Error("joints outside the registry should not be in RobotNum")
+	}
+}
@@ -0,0 +1,185 @@
+package khr_3hv
+
+import (
+	"encoding/json"
+	"fmt"
+	"kondocontrol/internal/robot"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Pose is the target positions of any subset of joints
+type Pose struct {
+	Name      string
+	Positions map[Kind]uint
+}
+
+// PoseCheck vets a pose before ApplyPose sends any of it
+type PoseCheck func(Pose) error
+
+// poseFile is how a pose is serialized, joints are keyed by name
+type poseFile struct {
+	Name      string          `json:"name,omitempty" yaml:"name,omitempty"`
+	Positions map[string]uint `json:"positions" yaml:"positions"`
+}
+
+// NewPose copies positions into a named pose
+func NewPose(name string, positions map[Kind]uint) Pose {
+	p := Pose{Name: name, Positions: make(map[Kind]uint, len(positions))}
+	for kind, position := range positions {
+		p.Positions[kind] = position
+	}
+	return p
+}
+
+// Kinds lists the joints of the pose in numeric order
+func (p Pose) Kinds() []Kind {
+	kinds := make([]Kind, 0, len(p.Positions))
+	for kind := range p.Positions {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+	return kinds
+}
+
+// Validate checks that every joint exists and every position can be sent to a servo
+func (p Pose) Validate() error {
+	for _, kind := range p.Kinds() {
+		if !kind.Valid() {
+			return fmt.Errorf("pose %s: %s is not a joint", p.Name, kind)
+		}
+		if position := p.Positions[kind]; position < robot.MinimumPosition || position > robot.MaximumPosition {
+			return fmt.Errorf("pose %s: %s position %d should be inside %d-%d", p.Name, kind, position, robot.MinimumPosition, robot.MaximumPosition)
+		}
+	}
+	return nil
+}
+
+// Blend moves weight of the way from p to other, Blend(crouch, 0.3) is
+// 70% p and 30% crouch. A joint in only one of the poses keeps its position.
+func (p Pose) Blend(other Pose, weight float64) Pose {
+	blended := NewPose(p.Name, p.Positions)
+	for kind, to := range other.Positions {
+		from, ok := p.Positions[kind]
+		if !ok {
+			blended.Positions[kind] = to
+			continue
+		}
+		blended.Positions[kind] = uint(math.Round(float64(from) + (float64(to)-float64(from))*weight))
+	}
+	return blended
+}
+
+func (p Pose) file() poseFile {
+	f := poseFile{Name: p.Name, Positions: make(map[string]uint, len(p.Positions))}
+	for kind, position := range p.Positions {
+		f.Positions[kind.String()] = position
+	}
+	return f
+}
+
+func (p *Pose) fromFile(f poseFile) error {
+	pose := Pose{Name: f.Name, Positions: make(map[Kind]uint, len(f.Positions))}
+	for name, position := range f.Positions {
+		kind, err := ParseKind(name)
+		if err != nil {
+			return fmt.Errorf("pose %s: %w", f.Name, err)
+		}
+		if _, ok := pose.Positions[kind]; ok {
+			return fmt.Errorf("pose %s: %s is given twice", f.Name, kind)
+		}
+		pose.Positions[kind] = position
+	}
+	if err := pose.Validate(); err != nil {
+		return err
+	}
+	*p = pose
+	return nil
+}
+
+// MarshalJSON writes the joints by name
+func (p Pose) MarshalJSON() ([]byte, error) {
+	return json.Marshal(p.file())
+}
+
+// UnmarshalJSON reads joints by name or number and validates the pose
+func (p *Pose) UnmarshalJSON(data []byte) error {
+	f := poseFile{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	return p.fromFile(f)
+}
+
+// MarshalYAML writes the joints by name
+func (p Pose) MarshalYAML() (interface{}, error) {
+	return p.file(), nil
+}
+
+// UnmarshalYAML reads joints by name or number and validates the pose
+func (p *Pose) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	f := poseFile{}
+	if err := unmarshal(&f); err != nil {
+		return err
+	}
+	return p.fromFile(f)
+}
+
+// ApplyPose checks the pose, then sends it with one goroutine per bus and
+// returns the position every joint reported back. A joint that would be
+// rejected by its limits stops the whole pose before anything is sent.
+func (r *RobotNum) ApplyPose(p Pose, checks ...PoseCheck) (Pose, error) {
+	if err := p.Validate(); err != nil {
+		return Pose{}, fmt.Errorf("[ApplyPose] %w", err)
+	}
+	for _, check := range checks {
+		if err := check(p); err != nil {
+			return Pose{}, fmt.Errorf("[ApplyPose] %w", err)
+		}
+	}
+	for _, kind := range p.Kinds() {
+		m := &r[kind]
+		if m.Joint.Limits.Mode == robot.Clamp {
+			continue
+		}
+		if _, err := m.checkLimits(p.Positions[kind]); err != nil {
+			return Pose{}, fmt.Errorf("[ApplyPose] %w", err)
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []string
+	)
+	for _, kinds := range r.Buses() {
+		wg.Add(1)
+		go func(kinds []Kind) {
+			defer wg.Done()
+			for _, kind := range kinds {
+				position, ok := p.Positions[kind]
+				if !ok {
+					continue
+				}
+				if err := r[kind].SetPosition(position); err != nil {
+					mu.Lock()
+					failed = append(failed, fmt.Sprintf("%s: %v", kind, err))
+					mu.Unlock()
+				}
+			}
+		}(kinds)
+	}
+	wg.Wait()
+
+	readback := Pose{Name: p.Name, Positions: make(map[Kind]uint, len(p.Positions))}
+	for _, kind := range p.Kinds() {
+		readback.Positions[kind] = r[kind].Position
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return readback, fmt.Errorf("[ApplyPose] %s", strings.Join(failed, "; "))
+	}
+	return readback, nil
+}
@@ -0,0 +1,115 @@
+package khr_3hv
+
+import (
+	"encoding/json"
+	"errors"
+	"kondocontrol/internal/robot"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestPoseBlend(t *testing.T) {
+	stand := NewPose("stand", map[Kind]uint{LeftKnee: 7500, RightKnee: 7500, Head: 7000})
+	crouch := NewPose("crouch", map[Kind]uint{LeftKnee: 9500, RightKnee: 5500, Waist: 8000})
+	p := stand.Blend(crouch, 0.3)
+	want := map[Kind]uint{LeftKnee: 8100, RightKnee: 6900, Head: 7000, Waist: 8000}
+	for kind, position := range want {
+		if p.Positions[kind] != position {
+			t.Errorf("%s should be %d, but actual %d", kind, position, p.Positions[kind])
+		}
+	}
+	if stand.Positions[LeftKnee] != 7500 {
+		t.Error("Blend should not change the pose")
+	}
+}
+
+func TestPoseSerialize(t *testing.T) {
+	p := NewPose("wave", map[Kind]uint{LeftShoulderRoll: 9000, Head: 7500})
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"name":"wave","positions":{"Head":7500,"LeftShoulderRoll":9000}}` {
+		t.Errorf("joints should be written by name, actual %s", data)
+	}
+	got := Pose{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "wave" || len(got.Positions) != 2 || got.Positions[LeftShoulderRoll] != 9000 {
+		t.Errorf("JSON round trip failed, actual %+v", got)
+	}
+
+	data, err = yaml.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = Pose{}
+	if err := yaml.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Name != "wave" || got.Positions[Head] != 7500 {
+		t.Errorf("YAML round trip failed, actual %+v", got)
+	}
+
+	for _, bad := range []string{
+		`{"positions":{"LeftElbow":7500}}`,
+		`{"positions":{"Head":20000}}`,
+		`{"positions":{"Head":7500,"0":7600}}`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &got); err == nil {
+			t.Errorf("%s should fail", bad)
+		}
+	}
+}
+
+func TestApplyPose(t *testing.T) {
+	r, left, right := newFakeRobot(t)
+	p := NewPose("reach", map[Kind]uint{LeftShoulderPitch: 9000, RightShoulderPitch: 6000, Waist: 7600})
+	readback, err := r.ApplyPose(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if left.servos[1].position != 9000 || right.servos[1].position != 6000 || right.servos[0].position != 7600 {
+		t.Error("every joint of the pose should be sent")
+	}
+	if len(readback.Positions) != 3 || readback.Positions[Waist] != 7600 {
+		t.Errorf("readback should be what the servos reported, actual %+v", readback)
+	}
+
+	r[LeftKnee].Joint.Limits = robot.Limits{Min: 5000, Max: 9000}
+	p = NewPose("kick", map[Kind]uint{LeftHipPitch: 8000, LeftKnee: 9500})
+	_, err = r.ApplyPose(p)
+	var violation *LimitViolation
+	if !errors.As(err, &violation) {
+		t.Fatalf("a rejected joint should stop the pose, actual %v", err)
+	}
+	if left.servos[5].position != 7500 {
+		t.Error("nothing should be sent when the pose is rejected")
+	}
+
+	vetoed := errors.New("vetoed")
+	if _, err := r.ApplyPose(NewPose("", map[Kind]uint{Head: 8000}), func(Pose) error { return vetoed }); !errors.Is(err, vetoed) {
+		t.Errorf("a failed check should stop the pose, actual %v", err)
+	}
+}
+
+func TestBusIdle(t *testing.T) {
+	r, _, _ := newFakeRobot(t)
+	if len(r.Buses()) != 2 {
+		t.Fatalf("default robot should have 2 buses, but actual %d", len(r.Buses()))
+	}
+	bus := r[Head].Bus()
+	time.Sleep(2 * time.Millisecond)
+	if bus.Idle() < time.Millisecond {
+		t.Errorf("bus should be idle, actual %v", bus.Idle())
+	}
+	if err := r[Head].SetPosition(7600); err != nil {
+		t.Fatal(err)
+	}
+	if bus.Idle() > time.Millisecond {
+		t.Errorf("bus was just used, actual idle %v", bus.Idle())
+	}
+}
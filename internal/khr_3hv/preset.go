@@ -0,0 +1,144 @@
+package khr_3hv
+
+import (
+	_ "embed"
+	"fmt"
+	"kondocontrol/internal/eeprom"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//go:embed presets.yaml
+var defaultPresets []byte
+
+// Preset is a named partial EEPROM overlay, only the fields in Overlay are changed
+type Preset struct {
+	Name        string            `yaml:"-"`
+	Description string            `yaml:"description"`
+	Group       string            `yaml:"group"`
+	Overlay     map[string]string `yaml:"overlay"`
+}
+
+// PresetResult is what a preset changes on one joint
+type PresetResult struct {
+	Kind       Kind
+	ID         uint8
+	Changes    []eeprom.Change
+	RolledBack bool
+	Err        error
+}
+
+// LoadPresets parses a preset file, every overlay value is checked against its EEPROM field
+func LoadPresets(data []byte) (map[string]Preset, error) {
+	presets := map[string]Preset{}
+	if err := yaml.UnmarshalStrict(data, &presets); err != nil {
+		return nil, err
+	}
+	for name, p := range presets {
+		p.Name = name
+		if p.Group != "" {
+			if _, err := Group(p.Group); err != nil {
+				return nil, fmt.Errorf("preset %s: %w", name, err)
+			}
+		}
+		e := eeprom.EEPROM{}
+		if err := p.apply(&e); err != nil {
+			return nil, fmt.Errorf("preset %s: %w", name, err)
+		}
+		presets[name] = p
+	}
+	return presets, nil
+}
+
+// DefaultPresets are the presets embedded in the package
+func DefaultPresets() map[string]Preset {
+	presets, err := LoadPresets(defaultPresets)
+	if err != nil {
+		panic(err)
+	}
+	return presets
+}
+
+// apply sets the overlay in a stable order
+func (p Preset) apply(e *eeprom.EEPROM) error {
+	names := make([]string, 0, len(p.Overlay))
+	for name := range p.Overlay {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := e.Set(name, p.Overlay[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Kinds returns kinds, or the group of the preset when kinds is empty
+func (p Preset) Kinds(kinds []Kind) ([]Kind, error) {
+	if len(kinds) > 0 {
+		return kinds, nil
+	}
+	if p.Group == "" {
+		return nil, fmt.Errorf("preset %s has no group, joints should be given", p.Name)
+	}
+	return Group(p.Group)
+}
+
+// PreviewPreset reads every joint and reports what the preset would change,
+// nothing is written
+func (r *RobotNum) PreviewPreset(p Preset, kinds []Kind) ([]PresetResult, error) {
+	kinds, err := p.Kinds(kinds)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]PresetResult, 0, len(kinds))
+	for _, kind := range kinds {
+		m := &r[kind]
+		origin, err := m.ReadEEPROM()
+		if err != nil {
+			return nil, fmt.Errorf("[PreviewPreset] kind %d: %w", kind, err)
+		}
+		target := m.EEPROM
+		if err := p.apply(&target); err != nil {
+			return nil, fmt.Errorf("[PreviewPreset] kind %d: %w", kind, err)
+		}
+		if _, err := eeprom.Compose(origin, target); err != nil {
+			return nil, fmt.Errorf("[PreviewPreset] kind %d: %w", kind, err)
+		}
+		results = append(results, PresetResult{Kind: kind, ID: m.GetID(), Changes: eeprom.Diff(m.EEPROM, target)})
+	}
+	return results, nil
+}
+
+// ApplyPreset writes the preset to every joint through UpdateEEPROM,
+// a joint that fails doesn't stop the others and is reported in its result
+func (r *RobotNum) ApplyPreset(p Preset, kinds []Kind) ([]PresetResult, error) {
+	kinds, err := p.Kinds(kinds)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		results = make([]PresetResult, 0, len(kinds))
+		failed  []string
+	)
+	for _, kind := range kinds {
+		update, err := r[kind].UpdateEEPROM(p.apply)
+		results = append(results, PresetResult{
+			Kind:       kind,
+			ID:         r[kind].GetID(),
+			Changes:    update.Changes,
+			RolledBack: update.RolledBack,
+			Err:        err,
+		})
+		if err != nil {
+			failed = append(failed, fmt.Sprint(kind))
+		}
+	}
+	if len(failed) > 0 {
+		return results, fmt.Errorf("[ApplyPreset] %s failed on joints %s", p.Name, strings.Join(failed, ", "))
+	}
+	return results, nil
+}
@@ -0,0 +1,62 @@
+package khr_3hv
+
+import (
+	"kondocontrol/internal/eeprom"
+	"testing"
+)
+
+func TestDefaultPresets(t *testing.T) {
+	for _, name := range []string{"compliant-arms", "stiff-legs", "factory-default"} {
+		if _, ok := DefaultPresets()[name]; !ok {
+			t.Errorf("preset %s is missing", name)
+		}
+	}
+	if _, err := LoadPresets([]byte("bad:\n  group: arms\n  overlay:\n    Punch: 11\n")); err == nil {
+		t.Error("This should be fail, becouse Punch should be less than or equal to 10")
+	}
+	if _, err := LoadPresets([]byte("bad:\n  group: tail\n")); err == nil {
+		t.Error("This should be fail, becouse tail is not a group")
+	}
+}
+
+func TestApplyPreset(t *testing.T) {
+	r, left, right := newFakeRobot(t)
+	p := DefaultPresets()["compliant-arms"]
+	writes := left.writes + right.writes
+
+	preview, err := r.PreviewPreset(p, nil)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(preview) != 8 {
+		t.Fatalf("arms are 8 joints, but actual %d", len(preview))
+	}
+	if len(preview[0].Changes) != 4 {
+		t.Errorf("preview should change 4 fields, actual %v", preview[0].Changes)
+	}
+	if left.writes+right.writes != writes {
+		t.Error("preview should not write")
+	}
+
+	results, err := r.ApplyPreset(p, nil)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	for _, result := range results {
+		port := left
+		if result.Kind >= RightShoulderPitch {
+			port = right
+		}
+		stored, err := eeprom.Parse(port.servos[result.ID].eeprom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.StretchGain != 40 || stored.Damping != 64 {
+			t.Errorf("kind %d should hold the preset, actual %+v", result.Kind, stored)
+		}
+	}
+	knee, _ := eeprom.Parse(left.servos[r[LeftKnee].GetID()].eeprom)
+	if knee.StretchGain != 120 {
+		t.Error("legs should not be changed by compliant-arms")
+	}
+}
@@ -0,0 +1,190 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// DefaultSamplePeriod is how often Record reads the joints, 20 Hz
+const DefaultSamplePeriod = 50 * time.Millisecond
+
+// Recorder samples joints moved by hand, see RobotNum.Record
+type Recorder struct {
+	robot  *RobotNum
+	name   string
+	kinds  []Kind
+	period time.Duration
+
+	mu        sync.Mutex
+	keyframes []Keyframe
+	err       error
+	stop      chan struct{}
+	once      sync.Once
+	done      chan struct{}
+}
+
+// Record frees the joints so they can be posed by hand and samples their
+// positions every period, DefaultSamplePeriod when zero. A free servo reports
+// its position without moving, so sampling doesn't fight the hand.
+func (r *RobotNum) Record(name string, kinds []Kind, period time.Duration) (*Recorder, error) {
+	if len(kinds) == 0 {
+		return nil, fmt.Errorf("[Record] no joint to record")
+	}
+	for _, kind := range kinds {
+		if !kind.Valid() {
+			return nil, fmt.Errorf("[Record] %s is not a joint", kind)
+		}
+	}
+	if period <= 0 {
+		period = DefaultSamplePeriod
+	}
+	rec := &Recorder{
+		robot:  r,
+		name:   name,
+		kinds:  kinds,
+		period: period,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go rec.run()
+	return rec, nil
+}
+
+func (rec *Recorder) run() {
+	defer close(rec.done)
+	ticker := time.NewTicker(rec.period)
+	defer ticker.Stop()
+	start := time.Now()
+	for {
+		pose, err := rec.sample()
+		at := time.Since(start)
+		rec.mu.Lock()
+		if err != nil {
+			rec.err = fmt.Errorf("[Record] at %v: %w", at, err)
+			rec.mu.Unlock()
+			return
+		}
+		if n := len(rec.keyframes); n > 0 && at <= rec.keyframes[n-1].Time {
+			at = rec.keyframes[n-1].Time + time.Millisecond
+		}
+		rec.keyframes = append(rec.keyframes, Keyframe{Time: at, Pose: pose})
+		rec.mu.Unlock()
+		select {
+		case <-rec.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample frees every joint once, one goroutine per bus, and keeps the reported positions
+func (rec *Recorder) sample() (Pose, error) {
+	byBus := map[*Bus][]Kind{}
+	for _, kind := range rec.kinds {
+		bus := rec.robot[kind].bus
+		byBus[bus] = append(byBus[bus], kind)
+	}
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		first error
+	)
+	for _, kinds := range byBus {
+		wg.Add(1)
+		go func(kinds []Kind) {
+			defer wg.Done()
+			for _, kind := range kinds {
+				if err := rec.robot[kind].SetFree(); err != nil {
+					mu.Lock()
+					if first == nil {
+						first = fmt.Errorf("%s: %w", kind, err)
+					}
+					mu.Unlock()
+				}
+			}
+		}(kinds)
+	}
+	wg.Wait()
+	if first != nil {
+		return Pose{}, first
+	}
+	pose := Pose{Positions: make(map[Kind]uint, len(rec.kinds))}
+	for _, kind := range rec.kinds {
+		pose.Positions[kind] = rec.robot[kind].Position
+	}
+	return pose, nil
+}
+
+// Samples is how many poses were recorded so far
+func (rec *Recorder) Samples() int {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return len(rec.keyframes)
+}
+
+// Stop ends the recording and returns every sample as a linear motion,
+// the joints are left free
+func (rec *Recorder) Stop() (Motion, error) {
+	rec.once.Do(func() { close(rec.stop) })
+	<-rec.done
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	m := Motion{Name: rec.name, Interpolation: Linear, Keyframes: append([]Keyframe{}, rec.keyframes...)}
+	if rec.err != nil {
+		return m, rec.err
+	}
+	return m, m.Validate()
+}
+
+// ReduceKeyframes drops keyframes that linear interpolation of the kept ones
+// reproduces within tolerance on every joint (Ramer-Douglas-Peucker).
+// The first and last keyframes are always kept.
+func ReduceKeyframes(m Motion, tolerance uint) Motion {
+	if len(m.Keyframes) < 3 {
+		return m
+	}
+	keep := make([]bool, len(m.Keyframes))
+	keep[0], keep[len(keep)-1] = true, true
+	reduce(m.Keyframes, 0, len(m.Keyframes)-1, float64(tolerance), keep)
+	reduced := m
+	reduced.Keyframes = nil
+	for i, k := range m.Keyframes {
+		if keep[i] {
+			reduced.Keyframes = append(reduced.Keyframes, k)
+		}
+	}
+	return reduced
+}
+
+func reduce(keyframes []Keyframe, from, to int, tolerance float64, keep []bool) {
+	if to-from < 2 {
+		return
+	}
+	a, b := keyframes[from], keyframes[to]
+	span := float64(b.Time - a.Time)
+	worst, index := 0.0, -1
+	for i := from + 1; i < to; i++ {
+		u := float64(keyframes[i].Time-a.Time) / span
+		for kind, position := range keyframes[i].Pose.Positions {
+			p0, ok0 := a.Pose.Positions[kind]
+			p1, ok1 := b.Pose.Positions[kind]
+			if !ok0 || !ok1 {
+				// a joint the ends don't both have can't be interpolated, keep it
+				worst, index = math.Inf(1), i
+				continue
+			}
+			d := math.Abs(float64(p0) + (float64(p1)-float64(p0))*u - float64(position))
+			if d > worst {
+				worst, index = d, i
+			}
+		}
+	}
+	if worst <= tolerance {
+		return
+	}
+	keep[index] = true
+	reduce(keyframes, from, index, tolerance, keep)
+	reduce(keyframes, index, to, tolerance, keep)
+}
@@ -0,0 +1,75 @@
+package khr_3hv
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRecord(t *testing.T) {
+	r, left, right := newFakeRobot(t)
+	rec, err := r.Record("teach", []Kind{LeftKnee, Waist}, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rec.Samples() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	left.mu.Lock()
+	left.servos[8].position = 9000
+	left.mu.Unlock()
+	samples := rec.Samples()
+	for rec.Samples() < samples+3 {
+		time.Sleep(time.Millisecond)
+	}
+	m, err := rec.Stop()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !left.servos[8].free || !right.servos[0].free {
+		t.Error("recorded joints should be free")
+	}
+	if left.servos[1].free {
+		t.Error("other joints should not be freed")
+	}
+	first, last := m.Keyframes[0].Pose, m.Keyframes[len(m.Keyframes)-1].Pose
+	if first.Positions[LeftKnee] != 7500 || last.Positions[LeftKnee] != 9000 || last.Positions[Waist] != 7500 {
+		t.Errorf("samples should follow the hand, first %v last %v", first.Positions, last.Positions)
+	}
+	if _, err := r.Record("none", nil, 0); err == nil {
+		t.Error("recording no joint should fail")
+	}
+}
+
+func TestReduceKeyframes(t *testing.T) {
+	m := Motion{Name: "ramp", Interpolation: Linear}
+	// a ramp up to 1s, flat to 2s, with 5 of noise
+	for i := 0; i <= 20; i++ {
+		position := uint(7500 + 100*i)
+		if i > 10 {
+			position = 8500
+		}
+		if i%2 == 1 {
+			position += 5
+		}
+		m.Keyframes = append(m.Keyframes, Keyframe{
+			Time: time.Duration(i) * 100 * time.Millisecond,
+			Pose: NewPose("", map[Kind]uint{Head: position}),
+		})
+	}
+	reduced := ReduceKeyframes(m, 10)
+	if len(reduced.Keyframes) != 3 {
+		t.Fatalf("ramp and flat should need 3 keyframes, but actual %d", len(reduced.Keyframes))
+	}
+	if reduced.Keyframes[1].Time != time.Second {
+		t.Errorf("the corner should be kept, actual %v", reduced.Keyframes[1].Time)
+	}
+	for _, k := range m.Keyframes {
+		d := int(reduced.At(k.Time).Positions[Head]) - int(k.Pose.Positions[Head])
+		if d > 10 || d < -10 {
+			t.Errorf("at %v reduced motion is %d away", k.Time, d)
+		}
+	}
+	if len(ReduceKeyframes(m, 0).Keyframes) < 20 {
+		t.Error("tolerance 0 should keep the noise")
+	}
+}
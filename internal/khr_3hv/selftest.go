@@ -0,0 +1,203 @@
+package khr_3hv
+
+import (
+	"fmt"
+	"kondocontrol/internal/eeprom"
+	"time"
+)
+
+// Self-test checks, in the order they run
+const (
+	CheckAnswer      = "answer"
+	CheckEEPROM      = "eeprom"
+	CheckID          = "id"
+	CheckLimits      = "limits"
+	CheckSignalSpeed = "signal-speed"
+	CheckTemperature = "temperature"
+	CheckMovement    = "movement"
+)
+
+// SelfTestConfig is how SelfTest moves joints and what temperature is nominal
+type SelfTestConfig struct {
+	// Move makes every joint do a small test movement, the robot should be on a stand
+	Move bool
+	// Amplitude is how far a joint moves, Settle how long it gets to get there
+	// and Tolerance how far from the target it may stop
+	Amplitude uint
+	Settle    time.Duration
+	Tolerance uint
+	// Temperature is the raw temperature a joint should read above, smaller is hotter
+	Temperature uint8
+}
+
+// DefaultSelfTestConfig moves every joint by about 3 degrees, a joint hotter
+// than the monitor warning is not nominal
+func DefaultSelfTestConfig() SelfTestConfig {
+	return SelfTestConfig{
+		Move:        true,
+		Amplitude:   100,
+		Settle:      300 * time.Millisecond,
+		Tolerance:   40,
+		Temperature: DefaultMonitorConfig().TemperatureWarn,
+	}
+}
+
+// CheckResult is one check of a joint, a skipped check neither passes nor fails
+type CheckResult struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// JointReport is every check of one joint
+type JointReport struct {
+	Kind   Kind          `json:"-"`
+	Joint  string        `json:"joint"`
+	ID     uint8         `json:"id"`
+	Checks []CheckResult `json:"checks"`
+}
+
+// Passed tells whether no check of the joint failed
+func (j JointReport) Passed() bool {
+	for _, c := range j.Checks {
+		if !c.Passed && !c.Skipped {
+			return false
+		}
+	}
+	return true
+}
+
+func (j *JointReport) add(name string, passed bool, format string, args ...interface{}) {
+	j.Checks = append(j.Checks, CheckResult{Name: name, Passed: passed, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (j *JointReport) skip(name, reason string) {
+	j.Checks = append(j.Checks, CheckResult{Name: name, Skipped: true, Detail: reason})
+}
+
+// SelfTest checks every joint of kinds against the robot description: the described ID answers,
+// its EEPROM passes validation and agrees with the ID, limits and signal speed of the description,
+// the temperature is nominal and, with config.Move, the joint follows a small movement and goes back.
+// A joint that doesn't answer skips the other checks. Nothing is written to the EEPROM.
+func (r *RobotNum) SelfTest(kinds []Kind, config SelfTestConfig) []JointReport {
+	reports := make([]JointReport, 0, len(kinds))
+	for _, kind := range kinds {
+		reports = append(reports, r[kind].selfTest(kind, config))
+	}
+	return reports
+}
+
+func (m *Motor) selfTest(kind Kind, config SelfTestConfig) JointReport {
+	report := JointReport{Kind: kind, Joint: kind.String(), ID: m.Joint.ID}
+	temperature, err := m.ReadTemperature()
+	if err != nil {
+		report.add(CheckAnswer, false, "id %d on port %s doesn't answer: %v", m.Joint.ID, m.Joint.Port, err)
+		for _, name := range []string{CheckEEPROM, CheckID, CheckLimits, CheckSignalSpeed, CheckTemperature, CheckMovement} {
+			report.skip(name, "no answer")
+		}
+		return report
+	}
+	report.add(CheckAnswer, true, "")
+
+	eepromOK := false
+	if _, err := m.ReadEEPROM(); err != nil {
+		report.add(CheckEEPROM, false, "%v", err)
+	} else if err := m.EEPROM.Validate(); err != nil {
+		report.add(CheckEEPROM, false, "%v", err)
+	} else {
+		eepromOK = true
+		report.add(CheckEEPROM, true, "")
+	}
+	if eepromOK {
+		report.add(CheckID, m.EEPROM.ID == m.Joint.ID, "EEPROM id %d, described %d", m.EEPROM.ID, m.Joint.ID)
+		report.checkLimits(m)
+		report.checkSignalSpeed(m)
+	} else {
+		for _, name := range []string{CheckID, CheckLimits, CheckSignalSpeed} {
+			report.skip(name, "EEPROM can't be read")
+		}
+	}
+	report.add(CheckTemperature, temperature > config.Temperature, "%d, nominal above %d", temperature, config.Temperature)
+
+	switch {
+	case !config.Move:
+		report.skip(CheckMovement, "not asked")
+	case !report.Passed():
+		report.skip(CheckMovement, "an earlier check failed")
+	default:
+		report.checkMovement(m, config)
+	}
+	return report
+}
+
+// checkLimits wants the described soft limits inside the EEPROM pulse limits,
+// or the servo stops short of a position the description allows
+func (j *JointReport) checkLimits(m *Motor) {
+	min, max := uint(m.EEPROM.MinimumPulseLimit), uint(m.EEPROM.MaximumPulseLimit)
+	described := m.Joint.Limits
+	if described.Min == 0 && described.Max == 0 {
+		j.add(CheckLimits, true, "EEPROM %d-%d, none described", min, max)
+		return
+	}
+	j.add(CheckLimits, described.Min >= min && (max == 0 || described.Max <= max),
+		"EEPROM %d-%d, described %d-%d", min, max, described.Min, described.Max)
+}
+
+func (j *JointReport) checkSignalSpeed(m *Motor) {
+	if m.Joint.SignalSpeed == "" {
+		j.skip(CheckSignalSpeed, "none described")
+		return
+	}
+	var described eeprom.SignalSpeed
+	if err := described.UnmarshalText([]byte(m.Joint.SignalSpeed)); err != nil {
+		j.add(CheckSignalSpeed, false, "%v", err)
+		return
+	}
+	j.add(CheckSignalSpeed, m.EEPROM.SignalSpeed == described, "EEPROM %s, described %s", m.EEPROM.SignalSpeed, described)
+}
+
+// checkMovement moves the joint by Amplitude towards the middle of its limits,
+// checks where it stopped and moves it back
+func (j *JointReport) checkMovement(m *Motor, config SelfTestConfig) {
+	if err := m.SetFree(); err != nil {
+		j.add(CheckMovement, false, "%v", err)
+		return
+	}
+	start := m.Position
+	min, max := m.Limits()
+	if start < min || start > max {
+		j.add(CheckMovement, false, "starts at %d outside its limits %d-%d", start, min, max)
+		return
+	}
+	target := start + config.Amplitude
+	if start > (min+max)/2 {
+		target = start - config.Amplitude
+	}
+	reached, err := m.moveAndSettle(target, config.Settle)
+	if err == nil {
+		_, err = m.moveAndSettle(start, config.Settle)
+	}
+	if err != nil {
+		j.add(CheckMovement, false, "%v", err)
+		return
+	}
+	off := int(reached) - int(target)
+	if off < 0 {
+		off = -off
+	}
+	j.add(CheckMovement, uint(off) <= config.Tolerance, "%d to %d reached %d, tolerance %d", start, target, reached, config.Tolerance)
+}
+
+// moveAndSettle commands target, waits and commands it again,
+// the reply of the second command is where the servo got to
+func (m *Motor) moveAndSettle(target uint, settle time.Duration) (uint, error) {
+	if err := m.SetPosition(target); err != nil {
+		return 0, err
+	}
+	time.Sleep(settle)
+	if err := m.SetPosition(target); err != nil {
+		return 0, err
+	}
+	return m.Position, nil
+}
@@ -0,0 +1,64 @@
+package khr_3hv
+
+import (
+	"testing"
+)
+
+func checkOf(report JointReport, name string) CheckResult {
+	for _, c := range report.Checks {
+		if c.Name == name {
+			return c
+		}
+	}
+	return CheckResult{}
+}
+
+func TestSelfTest(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	for _, s := range left.servos {
+		s.temperature = 110
+	}
+	// the elbow doesn't answer, the knee is hot and the hip is not on its described id
+	delete(left.servos, r[LeftElbowRoll].GetID())
+	left.servos[r[LeftKnee].GetID()].temperature = 60
+	r[LeftHipPitch].Joint.ID = 11
+	r[LeftHipPitch].SetID(5)
+
+	config := DefaultSelfTestConfig()
+	config.Settle = 0
+	reports := r.SelfTest([]Kind{Head, LeftElbowRoll, LeftKnee, LeftHipPitch}, config)
+	if len(reports) != 4 {
+		t.Fatalf("every joint should be reported, actual %d", len(reports))
+	}
+	head, elbow, knee, hip := reports[0], reports[1], reports[2], reports[3]
+
+	if !head.Passed() || len(head.Checks) != 7 {
+		t.Errorf("head should pass every check, actual %+v", head.Checks)
+	}
+	if c := checkOf(head, CheckMovement); !c.Passed || c.Detail != "7500 to 7600 reached 7600, tolerance 40" {
+		t.Errorf("head should move and come back, actual %+v", c)
+	}
+	if left.servos[0].position != 7500 {
+		t.Errorf("head should be back at 7500, actual %d", left.servos[0].position)
+	}
+	if c := checkOf(head, CheckSignalSpeed); !c.Passed {
+		t.Errorf("the stock description is at High, actual %+v", c)
+	}
+
+	if elbow.Passed() || checkOf(elbow, CheckAnswer).Passed || !checkOf(elbow, CheckEEPROM).Skipped {
+		t.Errorf("a silent elbow should fail and skip the rest, actual %+v", elbow.Checks)
+	}
+	if knee.Passed() || checkOf(knee, CheckTemperature).Passed || !checkOf(knee, CheckMovement).Skipped {
+		t.Errorf("a hot knee should fail and not move, actual %+v", knee.Checks)
+	}
+	if hip.Passed() || checkOf(hip, CheckID).Passed {
+		t.Errorf("a hip on another id should fail, actual %+v", hip.Checks)
+	}
+
+	r[Head].Joint.SignalSpeed = "Low"
+	config.Move = false
+	head = r.SelfTest([]Kind{Head}, config)[0]
+	if checkOf(head, CheckSignalSpeed).Passed || !checkOf(head, CheckMovement).Skipped {
+		t.Errorf("a Low description should not match, actual %+v", head.Checks)
+	}
+}
@@ -0,0 +1,127 @@
+package khr_3hv
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+// fakeServo is one servo on a fakePort
+type fakeServo struct {
+	eeprom      []byte
+	position    uint
+	free        bool
+	stretch     uint8
+	speed       uint8
+	current     uint8
+	temperature uint8
+	// corrupt changes the next written EEPROM image once
+	corrupt func(image []byte)
+}
+
+// fakePort answers ICS commands like a bus of servos,
+// every reply starts with the echo of the command
+type fakePort struct {
+	mu      sync.Mutex
+	servos  map[uint8]*fakeServo
+	pending []byte
+	writes  int
+}
+
+func newFakePort(t *testing.T, ids ...uint8) *fakePort {
+	t.Helper()
+	dat, err := ioutil.ReadFile("../eeprom/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakePort{servos: map[uint8]*fakeServo{}}
+	for _, id := range ids {
+		image := make([]byte, len(dat))
+		copy(image, dat)
+		image[56], image[57] = id>>4, id&0x0F
+		p.servos[id] = &fakeServo{eeprom: image, position: 7500, temperature: 80, current: 2}
+	}
+	return p
+}
+
+// newFakeRobot builds the default robot on two fake ports
+func newFakeRobot(t *testing.T) (RobotNum, *fakePort, *fakePort) {
+	t.Helper()
+	delay := eepromWriteDelay
+	eepromWriteDelay = 0
+	t.Cleanup(func() { eepromWriteDelay = delay })
+	ids := []uint8{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	left, right := newFakePort(t, ids...), newFakePort(t, ids...)
+	r, err := DefaultRobotNum(left, right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, left, right
+}
+
+func (p *fakePort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = append([]byte{}, b...)
+	cmd, id := b[0]&0xE0, b[0]&0x1F
+	s, ok := p.servos[id]
+	if !ok {
+		return len(b), nil
+	}
+	switch cmd {
+	case 0x80: // position
+		target := uint(b[1])<<7 + uint(b[2])
+		if target == 0 {
+			s.free = true
+		} else {
+			s.free = false
+			s.position = target
+		}
+		p.pending = append(p.pending, b[0]&0x7F, byte(s.position>>7)&0x7F, byte(s.position)&0x7F)
+	case 0xA0: // read
+		p.pending = append(p.pending, b[0]&0x7F, b[1])
+		switch b[1] {
+		case 0x00:
+			p.pending = append(p.pending, s.eeprom...)
+		case 0x01:
+			p.pending = append(p.pending, s.stretch)
+		case 0x02:
+			p.pending = append(p.pending, s.speed)
+		case 0x03:
+			p.pending = append(p.pending, s.current)
+		case 0x04:
+			p.pending = append(p.pending, s.temperature)
+		}
+	case 0xC0: // write
+		p.writes++
+		switch b[1] {
+		case 0x00:
+			s.eeprom = append([]byte{}, b[2:]...)
+			if s.corrupt != nil {
+				s.corrupt(s.eeprom)
+				s.corrupt = nil
+			}
+			newID := s.eeprom[56]<<4 + s.eeprom[57]
+			if newID != id {
+				delete(p.servos, id)
+				p.servos[newID] = s
+			}
+		case 0x01:
+			s.stretch = b[2]
+		case 0x02:
+			s.speed = b[2]
+		}
+		p.pending = append(p.pending, b[0]&0x7F, b[1])
+	}
+	return len(b), nil
+}
+
+func (p *fakePort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := copy(b, p.pending)
+	p.pending = p.pending[n:]
+	return n, nil
+}
+
+func (p *fakePort) Close() error { return nil }
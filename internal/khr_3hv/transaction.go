@@ -0,0 +1,76 @@
+package khr_3hv
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"kondocontrol/internal/eeprom"
+)
+
+// ErrVerifyFailed is when the EEPROM read back after a write is not what was written
+var ErrVerifyFailed = errors.New("EEPROM verify failed")
+
+// EEPROMUpdate is the result of Motor.UpdateEEPROM
+type EEPROMUpdate struct {
+	Before     eeprom.EEPROM
+	After      eeprom.EEPROM
+	Changes    []eeprom.Change
+	RolledBack bool
+}
+
+// UpdateEEPROM reads the EEPROM, applies mutate to it, validates and writes it,
+// then reads it back to compare. If the servo doesn't hold exactly what was
+// written, the original image is written back and RolledBack is set.
+// Nothing is written when mutate doesn't change anything.
+func (m *Motor) UpdateEEPROM(mutate func(e *eeprom.EEPROM) error) (EEPROMUpdate, error) {
+	origin, err := m.ReadEEPROM()
+	if err != nil {
+		return EEPROMUpdate{}, fmt.Errorf("[UpdateEEPROM] read: %w", err)
+	}
+	result := EEPROMUpdate{Before: m.EEPROM}
+	target := m.EEPROM
+	if err := mutate(&target); err != nil {
+		return result, err
+	}
+	target.Address = result.Before.Address
+	composed, err := eeprom.Compose(origin, target)
+	if err != nil {
+		return result, fmt.Errorf("[UpdateEEPROM] validate: %w", err)
+	}
+	result.After = target
+	result.Changes = eeprom.Diff(result.Before, target)
+	if len(result.Changes) == 0 {
+		return result, nil
+	}
+
+	verifyErr := m.writeAndVerify(composed, target.ID)
+	if verifyErr == nil {
+		return result, nil
+	}
+	// roll back, the servo answers to the new ID if the write went through
+	if err := m.writeAndVerify(origin, result.Before.ID); err != nil {
+		m.SetID(result.Before.ID)
+		if err := m.writeAndVerify(origin, result.Before.ID); err != nil {
+			return result, fmt.Errorf("[UpdateEEPROM] %v, and rollback failed: %w", verifyErr, err)
+		}
+	}
+	result.After = result.Before
+	result.RolledBack = true
+	return result, fmt.Errorf("[UpdateEEPROM] rolled back: %w", verifyErr)
+}
+
+// writeAndVerify writes data to the current ID and reads it back from newID
+func (m *Motor) writeAndVerify(data []byte, newID uint8) error {
+	if err := m.WriteEEPROM(data); err != nil {
+		return err
+	}
+	m.SetID(newID)
+	readBack, err := m.ReadEEPROM()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrVerifyFailed, err)
+	}
+	if !bytes.Equal(readBack, data) {
+		return fmt.Errorf("%w: wrote %X, read back %X", ErrVerifyFailed, data, readBack)
+	}
+	return nil
+}
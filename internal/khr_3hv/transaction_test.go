@@ -0,0 +1,63 @@
+package khr_3hv
+
+import (
+	"errors"
+	"kondocontrol/internal/eeprom"
+	"testing"
+)
+
+func TestUpdateEEPROM(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	result, err := r[LeftKnee].UpdateEEPROM(func(e *eeprom.EEPROM) error {
+		e.Punch = 4
+		e.Flag.Reverse = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+	if len(result.Changes) != 2 || result.Changes[0].Field != "Punch" || result.Changes[1].Field != "Flag.Reverse" {
+		t.Errorf("changes should be Punch and Flag.Reverse, actual %v", result.Changes)
+	}
+	stored, err := eeprom.Parse(left.servos[r[LeftKnee].GetID()].eeprom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Punch != 4 || !stored.Flag.Reverse {
+		t.Errorf("servo should hold the new EEPROM, actual %+v", stored)
+	}
+
+	writes := left.writes
+	if _, err := r[LeftKnee].UpdateEEPROM(func(e *eeprom.EEPROM) error {
+		e.Punch = 11
+		return nil
+	}); err == nil {
+		t.Error("This should be fail, becouse Punch should be less than or equal to 10")
+	}
+	if left.writes != writes {
+		t.Error("invalid EEPROM should not be written")
+	}
+}
+
+func TestUpdateEEPROMRollback(t *testing.T) {
+	r, left, _ := newFakeRobot(t)
+	servo := left.servos[r[LeftHipYaw].GetID()]
+	origin := append([]byte{}, servo.eeprom...)
+	servo.corrupt = func(image []byte) { image[5] = 0x0E }
+
+	result, err := r[LeftHipYaw].UpdateEEPROM(func(e *eeprom.EEPROM) error {
+		e.Damping = 40
+		return nil
+	})
+	if !errors.Is(err, ErrVerifyFailed) {
+		t.Fatalf("verify should fail, actual: %+v", err)
+	}
+	if !result.RolledBack {
+		t.Error("result should be rolled back")
+	}
+	for i := range origin {
+		if servo.eeprom[i] != origin[i] {
+			t.Fatalf("servo should hold the original EEPROM\norigin: %v\nactual: %v", origin, servo.eeprom)
+		}
+	}
+}
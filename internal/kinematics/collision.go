@@ -0,0 +1,148 @@
+package kinematics
+
+import (
+	"errors"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"math"
+	"time"
+)
+
+// Capsule is the segment From-To in the frame of Link grown by Radius, in mm
+type Capsule struct {
+	Link   string  `yaml:"link"`
+	From   Vec3    `yaml:"from,flow"`
+	To     Vec3    `yaml:"to,flow"`
+	Radius float64 `yaml:"radius"`
+}
+
+// ErrCollision is wrapped by the errors of a pose where links intersect
+var ErrCollision = errors.New("self collision")
+
+// Collision is a pair of intersecting links, Depth is how far their capsules overlap in mm
+type Collision struct {
+	A     string  `json:"a"`
+	B     string  `json:"b"`
+	Depth float64 `json:"depth"`
+}
+
+// Collisions finds every pair of links whose capsules intersect,
+// a joint missing in angles is at zero
+func (m *Model) Collisions(angles map[khr_3hv.Kind]float64) []Collision {
+	frames := m.Forward(angles)
+	ignored := m.collisionIgnored()
+	var collisions []Collision
+	for i, a := range m.Capsules {
+		for _, b := range m.Capsules[i+1:] {
+			if ignored[[2]string{a.Link, b.Link}] {
+				continue
+			}
+			fa, fb := frames[a.Link], frames[b.Link]
+			d := segmentDistance(fa.Apply(a.From), fa.Apply(a.To), fb.Apply(b.From), fb.Apply(b.To))
+			if depth := a.Radius + b.Radius - d; depth > 0 {
+				collisions = append(collisions, Collision{A: a.Link, B: b.Link, Depth: depth})
+			}
+		}
+	}
+	return collisions
+}
+
+// collisionIgnored are the pairs of links that never collide: the same link, a link and its
+// parent, as they always touch at the joint between them, and CollisionIgnore. Links further
+// apart, like the chest and an upper arm behind a shoulder link, are checked.
+func (m *Model) collisionIgnored() map[[2]string]bool {
+	ignored := map[[2]string]bool{}
+	ignore := func(a, b string) {
+		ignored[[2]string{a, b}] = true
+		ignored[[2]string{b, a}] = true
+	}
+	for _, c := range m.Capsules {
+		ignore(c.Link, c.Link)
+	}
+	for _, l := range m.Links {
+		ignore(l.Name, l.Parent)
+	}
+	for _, pair := range m.CollisionIgnore {
+		ignore(pair[0], pair[1])
+	}
+	return ignored
+}
+
+// CollisionCheck rejects a pose where links intersect, to be given to ApplyPose or Play.
+// Joints missing in the pose are taken from the last positions of r, or straight when r is nil.
+func (m *Model) CollisionCheck(c Calibration, r *khr_3hv.RobotNum) khr_3hv.PoseCheck {
+	return func(p khr_3hv.Pose) error {
+		full := khr_3hv.Pose{Positions: map[khr_3hv.Kind]uint{}}
+		if r != nil {
+			full = r.Current(khr_3hv.Kinds())
+		}
+		for kind, position := range p.Positions {
+			full.Positions[kind] = position
+		}
+		if collisions := m.Collisions(c.Angles(full)); len(collisions) > 0 {
+			return fmt.Errorf("%w: %s and %s overlap %.1f mm", ErrCollision, collisions[0].A, collisions[0].B, collisions[0].Depth)
+		}
+		return nil
+	}
+}
+
+// MotionCollision is a sample of a motion where links intersect
+type MotionCollision struct {
+	Time       time.Duration `json:"time"`
+	Collisions []Collision   `json:"collisions"`
+}
+
+// CheckMotionCollisions samples the interpolated motion every period, the last keyframe
+// included, and flags every sample where links intersect
+func (m *Model) CheckMotionCollisions(c Calibration, motion khr_3hv.Motion, period time.Duration) ([]MotionCollision, error) {
+	if err := motion.Validate(); err != nil {
+		return nil, err
+	}
+	if period <= 0 {
+		period = khr_3hv.DefaultControlPeriod
+	}
+	var flagged []MotionCollision
+	duration := motion.Duration()
+	for t := time.Duration(0); ; t += period {
+		if t > duration {
+			t = duration
+		}
+		if collisions := m.Collisions(c.Angles(motion.At(t))); len(collisions) > 0 {
+			flagged = append(flagged, MotionCollision{Time: t, Collisions: collisions})
+		}
+		if t == duration {
+			return flagged, nil
+		}
+	}
+}
+
+// segmentDistance is the shortest distance between the segments p1-q1 and p2-q2
+func segmentDistance(p1, q1, p2, q2 Vec3) float64 {
+	d1, d2, r := q1.Sub(p1), q2.Sub(p2), p1.Sub(p2)
+	a, e, f := d1.Dot(d1), d2.Dot(d2), d2.Dot(r)
+	clamp := func(x float64) float64 { return math.Max(0, math.Min(1, x)) }
+	var s, t float64
+	switch {
+	case a < 1e-12 && e < 1e-12:
+		return r.Norm()
+	case a < 1e-12:
+		t = clamp(f / e)
+	default:
+		c := d1.Dot(r)
+		if e < 1e-12 {
+			s = clamp(-c / a)
+			break
+		}
+		b := d1.Dot(d2)
+		if denom := a*e - b*b; denom > 1e-12 {
+			s = clamp((b*f - c*e) / denom)
+		}
+		t = (b*s + f) / e
+		if t < 0 {
+			t, s = 0, clamp(-c/a)
+		} else if t > 1 {
+			t, s = 1, clamp((b-c)/a)
+		}
+	}
+	return p1.Add(d1.Scale(s)).Sub(p2.Add(d2.Scale(t))).Norm()
+}
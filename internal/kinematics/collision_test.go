@@ -0,0 +1,106 @@
+package kinematics
+
+import (
+	"errors"
+	"kondocontrol/internal/khr_3hv"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSegmentDistance(t *testing.T) {
+	cases := []struct {
+		p1, q1, p2, q2 Vec3
+		want           float64
+	}{
+		{Vec3{0, 0, 0}, Vec3{10, 0, 0}, Vec3{5, 3, 0}, Vec3{5, 3, 10}, 3},  // crossing
+		{Vec3{0, 0, 0}, Vec3{10, 0, 0}, Vec3{0, 4, 0}, Vec3{10, 4, 0}, 4},  // parallel
+		{Vec3{0, 0, 0}, Vec3{10, 0, 0}, Vec3{13, 4, 0}, Vec3{20, 4, 0}, 5}, // end to end
+		{Vec3{0, 0, 0}, Vec3{0, 0, 0}, Vec3{3, 4, 0}, Vec3{3, 4, 0}, 5},    // points
+	}
+	for _, c := range cases {
+		if d := segmentDistance(c.p1, c.q1, c.p2, c.q2); math.Abs(d-c.want) > 1e-9 {
+			t.Errorf("%v-%v to %v-%v should be %v, but actual %v", c.p1, c.q1, c.p2, c.q2, c.want, d)
+		}
+	}
+}
+
+func TestCollisions(t *testing.T) {
+	m := DefaultModel()
+	if collisions := m.Collisions(nil); len(collisions) != 0 {
+		t.Errorf("a straight robot should not collide, actual %v", collisions)
+	}
+	// crossing the legs puts the left leg through the right one
+	collisions := m.Collisions(map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: -0.4})
+	if !hasCollision(collisions, "LeftShin", "RightShin") {
+		t.Errorf("crossed legs should collide, actual %v", collisions)
+	}
+	// the same roll outward is free
+	if collisions := m.Collisions(map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: 0.4}); len(collisions) != 0 {
+		t.Errorf("a leg out to the side should not collide, actual %v", collisions)
+	}
+	// swinging the arm in hits the torso, the upper arm too though
+	// a shoulder link without a capsule is between it and the chest
+	collisions = m.Collisions(map[khr_3hv.Kind]float64{khr_3hv.LeftShoulderRoll: -0.8})
+	for _, link := range []string{"LeftUpperArm", "LeftForearm"} {
+		if !hasCollision(collisions, "Chest", link) {
+			t.Errorf("%s through the torso should collide, actual %v", link, collisions)
+		}
+	}
+
+	m.CollisionIgnore = append(m.CollisionIgnore, [][2]string{{"LeftUpperArm", "Chest"}, {"LeftForearm", "Chest"}, {"Pelvis", "LeftForearm"}}...)
+	if collisions := m.Collisions(map[khr_3hv.Kind]float64{khr_3hv.LeftShoulderRoll: -0.8}); len(collisions) != 0 {
+		t.Errorf("ignored pairs should not collide, actual %v", collisions)
+	}
+}
+
+func hasCollision(collisions []Collision, a, b string) bool {
+	for _, c := range collisions {
+		if c.A == a && c.B == b || c.A == b && c.B == a {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCollisionCheck(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	check := m.CollisionCheck(c, nil)
+	if err := check(c.Pose("", map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: 0.4})); err != nil {
+		t.Error(err)
+	}
+	if err := check(c.Pose("", map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: -0.4})); !errors.Is(err, ErrCollision) {
+		t.Errorf("crossed legs should be rejected with ErrCollision, actual %v", err)
+	}
+
+	// joints missing in the pose come from the robot
+	r := khr_3hv.RobotNum{}
+	r[khr_3hv.LeftHipRoll].Position = c.Pose("", map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: -0.4}).Positions[khr_3hv.LeftHipRoll]
+	if err := m.CollisionCheck(c, &r)(c.Pose("", map[khr_3hv.Kind]float64{khr_3hv.Head: 0.5})); !errors.Is(err, ErrCollision) {
+		t.Errorf("the crossed legs of the robot should be rejected, actual %v", err)
+	}
+}
+
+func TestCheckMotionCollisions(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	out := c.Pose("out", map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: 0.3})
+	in := c.Pose("in", map[khr_3hv.Kind]float64{khr_3hv.LeftHipRoll: -0.3})
+	// swinging the leg in crosses the legs around the middle keyframe
+	motion := khr_3hv.Motion{Name: "swing", Keyframes: []khr_3hv.Keyframe{
+		{Time: 0, Pose: out},
+		{Time: time.Second, Pose: in},
+		{Time: 2 * time.Second, Pose: out},
+	}}
+	flagged, err := m.CheckMotionCollisions(c, motion, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(flagged) == 0 {
+		t.Fatal("crossing the legs should be flagged")
+	}
+	for _, f := range flagged {
+		if f.Time < 500*time.Millisecond || f.Time > 1500*time.Millisecond {
+			t.Errorf("only the samples around the crossing should be flagged, actual %v", f.Time)
+		}
+	}
+}
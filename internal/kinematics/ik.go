@@ -0,0 +1,245 @@
+package kinematics
+
+import (
+	"errors"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/robot"
+	"math"
+)
+
+// Side picks a leg or an arm
+type Side string
+
+const (
+	Left  Side = "Left"
+	Right Side = "Right"
+)
+
+// legJoints are the joints of a leg from the hip down, without the side prefix
+var legJoints = []string{"HipYaw", "HipRoll", "HipPitch", "Knee", "AnklePitch", "AnkleRoll"}
+
+// ErrUnreachable is wrapped by the errors of a target the leg can't reach
+var ErrUnreachable = errors.New("unreachable")
+
+// IK tuning, the orientation error is weighted as if a radian were orientationScale millimetres
+const (
+	ikIterations     = 200
+	ikDamping        = 5.0
+	orientationScale = 100.0
+	positionTol      = 0.1
+	orientationTol   = 1e-3
+)
+
+// leg is the joints, links and end effector of one leg
+type leg struct {
+	kinds []khr_3hv.Kind
+	links []Link
+	end   string
+}
+
+func (m *Model) leg(side Side) (leg, error) {
+	l := leg{}
+	for _, name := range legJoints {
+		kind, err := khr_3hv.ParseKind(string(side) + name)
+		if err != nil {
+			return l, err
+		}
+		link, ok := m.jointLink(kind)
+		if !ok {
+			return l, fmt.Errorf("joint %s doesn't move any link of %s", kind, m.Name)
+		}
+		l.kinds = append(l.kinds, kind)
+		l.links = append(l.links, link)
+	}
+	// the foot is the effector below the last joint
+	last := l.links[len(l.links)-1].Name
+	for _, name := range m.Effectors {
+		if m.descends(name, last) {
+			l.end = name
+			return l, nil
+		}
+	}
+	return l, fmt.Errorf("no effector below %s of %s", last, m.Name)
+}
+
+func (m *Model) jointLink(kind khr_3hv.Kind) (Link, bool) {
+	for _, l := range m.Links {
+		if l.Joint != "" && l.kind == kind {
+			return l, true
+		}
+	}
+	return Link{}, false
+}
+
+// descends reports whether link is ancestor or below it
+func (m *Model) descends(link, ancestor string) bool {
+	for link != "" && link != m.Base {
+		if link == ancestor {
+			return true
+		}
+		l, ok := m.Link(link)
+		if !ok {
+			return false
+		}
+		link = l.Parent
+	}
+	return ancestor == m.Base
+}
+
+// Hip is the frame of the hip of a leg in the base frame,
+// at the hip yaw joint and not turned by it
+func (m *Model) Hip(side Side) (Transform, error) {
+	l, err := m.leg(side)
+	if err != nil {
+		return Transform{}, err
+	}
+	frames := m.Forward(nil)
+	yaw := l.links[0]
+	return frames[yaw.Parent].Mul(Transform{R: Identity(), P: yaw.Origin}), nil
+}
+
+// LegJoints are the joints of a leg from the hip down
+func (m *Model) LegJoints(side Side) ([]khr_3hv.Kind, error) {
+	l, err := m.leg(side)
+	if err != nil {
+		return nil, err
+	}
+	return l.kinds, nil
+}
+
+// Foot is the effector at the end of a leg
+func (m *Model) Foot(side Side) (string, error) {
+	l, err := m.leg(side)
+	if err != nil {
+		return "", err
+	}
+	return l.end, nil
+}
+
+// LegIK finds the leg joint positions that put the foot at target, given
+// in the hip frame of the leg. Joints stay inside their calibrated limits,
+// a target out of reach or not reached within limits wraps ErrUnreachable.
+func (m *Model) LegIK(c Calibration, side Side, target Transform) (khr_3hv.Pose, error) {
+	l, err := m.leg(side)
+	if err != nil {
+		return khr_3hv.Pose{}, fmt.Errorf("[LegIK] %w", err)
+	}
+	hip, err := m.Hip(side)
+	if err != nil {
+		return khr_3hv.Pose{}, fmt.Errorf("[LegIK] %w", err)
+	}
+	goal := hip.Mul(target)
+
+	// the distance from the hip pitch axis to the ankle can't exceed thigh and shin
+	straight := m.Forward(nil)
+	ankle, pitch := straight[l.links[4].Name].P, straight[l.links[2].Name].P
+	reach := straight[l.links[3].Name].P.Sub(pitch).Norm() + ankle.Sub(straight[l.links[3].Name].P).Norm()
+	footInAnkle := straight[l.links[5].Name].Inverse().Apply(straight[l.end].P)
+	wantAnkle := goal.Apply(footInAnkle.Scale(-1))
+	hipToAnkle := wantAnkle.Sub(pitch).Norm()
+	if hipToAnkle > reach+positionTol {
+		return khr_3hv.Pose{}, fmt.Errorf("[LegIK] %w: %s ankle would be %.1f mm from the hip, the leg reaches %.1f mm", ErrUnreachable, side, hipToAnkle, reach)
+	}
+
+	lower, upper := make([]float64, len(l.kinds)), make([]float64, len(l.kinds))
+	for i, kind := range l.kinds {
+		lower[i], upper[i] = c.angleLimits(kind)
+	}
+	// start from a slightly bent knee, a straight knee is singular
+	angles := map[khr_3hv.Kind]float64{}
+	seed := []float64{0, 0, -0.2, 0.4, -0.2, 0}
+	for i, kind := range l.kinds {
+		angles[kind] = math.Max(lower[i], math.Min(upper[i], seed[i]))
+	}
+
+	var position, orientation float64
+	for iteration := 0; iteration < ikIterations; iteration++ {
+		frames := m.Forward(angles)
+		end := frames[l.end]
+		dp := goal.P.Sub(end.P)
+		dr := goal.R.Mul(end.R.Transpose()).Log()
+		position, orientation = dp.Norm(), dr.Norm()
+		if position < positionTol && orientation < orientationTol {
+			return c.Pose(fmt.Sprintf("%s-leg", side), angles), nil
+		}
+		e := [6]float64{dp[0], dp[1], dp[2], dr[0] * orientationScale, dr[1] * orientationScale, dr[2] * orientationScale}
+		var jacobian [6][6]float64
+		for i, link := range l.links {
+			axis := frames[link.Name].R.Apply(link.Axis)
+			linear := axis.Cross(end.P.Sub(frames[link.Name].P))
+			for row := 0; row < 3; row++ {
+				jacobian[row][i] = linear[row]
+				jacobian[row+3][i] = axis[row] * orientationScale
+			}
+		}
+		step, err := dampedLeastSquares(jacobian, e, ikDamping)
+		if err != nil {
+			break
+		}
+		for i, kind := range l.kinds {
+			angles[kind] = math.Max(lower[i], math.Min(upper[i], angles[kind]+step[i]))
+		}
+	}
+	return khr_3hv.Pose{}, fmt.Errorf("[LegIK] %w: %s foot stays %.1f mm and %.1f degrees from the target within the joint limits",
+		ErrUnreachable, side, position, orientation*180/math.Pi)
+}
+
+// angleLimits is the range of the joint in radians, from its limits or the servo range,
+// see WithLimits for the EEPROM pulse limits
+func (c Calibration) angleLimits(kind khr_3hv.Kind) (float64, float64) {
+	j := c.joint(kind)
+	min, max := robot.MinimumPosition, robot.MaximumPosition
+	if j.Limits.Min != 0 || j.Limits.Max != 0 {
+		min, max = j.Limits.Min, j.Limits.Max
+	}
+	a := float64(khr_3hv.Angle(j, min)) / PositionsPerRadian
+	b := float64(khr_3hv.Angle(j, max)) / PositionsPerRadian
+	return math.Min(a, b), math.Max(a, b)
+}
+
+// dampedLeastSquares solves J dq = e as dq = J^T (J J^T + λ²I)^-1 e
+func dampedLeastSquares(j [6][6]float64, e [6]float64, lambda float64) ([6]float64, error) {
+	var a [6][7]float64
+	for r := 0; r < 6; r++ {
+		for c := 0; c < 6; c++ {
+			for k := 0; k < 6; k++ {
+				a[r][c] += j[r][k] * j[c][k]
+			}
+		}
+		a[r][r] += lambda * lambda
+		a[r][6] = e[r]
+	}
+	// Gauss-Jordan with partial pivoting
+	for col := 0; col < 6; col++ {
+		pivot := col
+		for r := col + 1; r < 6; r++ {
+			if math.Abs(a[r][col]) > math.Abs(a[pivot][col]) {
+				pivot = r
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return [6]float64{}, errors.New("singular")
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for r := 0; r < 6; r++ {
+			if r == col {
+				continue
+			}
+			f := a[r][col] / a[col][col]
+			for c := col; c < 7; c++ {
+				a[r][c] -= f * a[col][c]
+			}
+		}
+	}
+	var y, dq [6]float64
+	for r := 0; r < 6; r++ {
+		y[r] = a[r][6] / a[r][r]
+	}
+	for c := 0; c < 6; c++ {
+		for r := 0; r < 6; r++ {
+			dq[c] += j[r][c] * y[r]
+		}
+	}
+	return dq, nil
+}
@@ -0,0 +1,87 @@
+package kinematics
+
+import (
+	"errors"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/robot"
+	"testing"
+)
+
+func TestLegIK(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	for _, side := range []Side{Left, Right} {
+		hip, err := m.Hip(side)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets := []map[string]float64{
+			{"HipYaw": 0.1, "HipRoll": 0.05, "HipPitch": -0.5, "Knee": 1.0, "AnklePitch": -0.5, "AnkleRoll": -0.05},
+			{"HipYaw": -0.2, "HipRoll": -0.1, "HipPitch": -0.2, "Knee": 0.6, "AnklePitch": -0.3, "AnkleRoll": 0.1},
+		}
+		for _, target := range targets {
+			angles := map[khr_3hv.Kind]float64{}
+			for name, angle := range target {
+				kind, _ := khr_3hv.ParseKind(string(side) + name)
+				angles[kind] = angle
+			}
+			foot := m.Forward(angles)[string(side)+"Foot"]
+			goal := hip.Inverse().Mul(foot)
+
+			p, err := m.LegIK(c, side, goal)
+			if err != nil {
+				t.Fatalf("%s %v: %v", side, target, err)
+			}
+			if len(p.Positions) != 6 {
+				t.Errorf("IK should set the 6 leg joints, actual %v", p.Positions)
+			}
+			reached := m.ForwardPose(c, p)[string(side)+"Foot"]
+			if d := reached.P.Sub(foot.P).Norm(); d > 1 {
+				t.Errorf("%s: foot should be reached within 1 mm, actual %.2f mm", side, d)
+			}
+			if d := reached.R.Mul(foot.R.Transpose()).Log().Norm(); d > 0.01 {
+				t.Errorf("%s: foot orientation should be reached, actual %.4f rad away", side, d)
+			}
+		}
+	}
+}
+
+func TestLegIKUnreachable(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	far := Transform{R: Identity(), P: Vec3{0, 0, -300}}
+	if _, err := m.LegIK(c, Left, far); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("a foot 300 mm below the hip should be unreachable, actual %v", err)
+	}
+
+	// a knee that may only bend a little can't crouch
+	j := c[khr_3hv.LeftKnee]
+	j.Limits = robot.Limits{Min: 7400, Max: 7800}
+	c[khr_3hv.LeftKnee] = j
+	crouch := Transform{R: Identity(), P: Vec3{0, 0, -150}}
+	if _, err := m.LegIK(c, Left, crouch); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("a crouch should be unreachable with the knee limited, actual %v", err)
+	}
+	if _, err := m.LegIK(DefaultCalibration(), Left, crouch); err != nil {
+		t.Errorf("a crouch should be reachable, actual %v", err)
+	}
+}
+
+func TestLegIKPulseLimits(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	// the described knee range is free, the EEPROM only lets it bend a little
+	var r khr_3hv.RobotNum
+	for _, kind := range khr_3hv.Kinds() {
+		r[kind].Joint = c[kind]
+	}
+	r[khr_3hv.LeftKnee].EEPROM.MinimumPulseLimit, r[khr_3hv.LeftKnee].EEPROM.MaximumPulseLimit = 7400, 7800
+	limited := c.WithLimits(&r)
+	if j := limited[khr_3hv.LeftKnee]; j.Limits.Min != 7400 || j.Limits.Max != 7800 {
+		t.Fatalf("knee limits should be 7400-7800, actual %+v", j.Limits)
+	}
+	if c[khr_3hv.LeftKnee].Limits != (robot.Limits{}) {
+		t.Error("WithLimits should not change the calibration")
+	}
+	crouch := Transform{R: Identity(), P: Vec3{0, 0, -150}}
+	if _, err := m.LegIK(limited, Left, crouch); !errors.Is(err, ErrUnreachable) {
+		t.Errorf("a crouch should be unreachable within the EEPROM limits, actual %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package kinematics
+
+import "math"
+
+// Vec3 is a point or a direction in millimetres, x forward, y left and z up
+type Vec3 [3]float64
+
+// Add is the sum of v and w
+func (v Vec3) Add(w Vec3) Vec3 {
+	return Vec3{v[0] + w[0], v[1] + w[1], v[2] + w[2]}
+}
+
+// Sub is v minus w
+func (v Vec3) Sub(w Vec3) Vec3 {
+	return Vec3{v[0] - w[0], v[1] - w[1], v[2] - w[2]}
+}
+
+// Scale multiplies every component of v by s
+func (v Vec3) Scale(s float64) Vec3 {
+	return Vec3{v[0] * s, v[1] * s, v[2] * s}
+}
+
+// Dot is the dot product of v and w
+func (v Vec3) Dot(w Vec3) float64 {
+	return v[0]*w[0] + v[1]*w[1] + v[2]*w[2]
+}
+
+// Cross is the right-handed cross product of v and w
+func (v Vec3) Cross(w Vec3) Vec3 {
+	return Vec3{
+		v[1]*w[2] - v[2]*w[1],
+		v[2]*w[0] - v[0]*w[2],
+		v[0]*w[1] - v[1]*w[0],
+	}
+}
+
+// Norm is the length of v
+func (v Vec3) Norm() float64 {
+	return math.Sqrt(v.Dot(v))
+}
+
+// Mat3 is a rotation matrix, row major
+type Mat3 [3][3]float64
+
+// Identity is the rotation that does nothing
+func Identity() Mat3 {
+	return Mat3{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+}
+
+// Rotation turns angle radians around the unit axis, right-handed
+func Rotation(axis Vec3, angle float64) Mat3 {
+	c, s := math.Cos(angle), math.Sin(angle)
+	t := 1 - c
+	x, y, z := axis[0], axis[1], axis[2]
+	return Mat3{
+		{t*x*x + c, t*x*y - s*z, t*x*z + s*y},
+		{t*x*y + s*z, t*y*y + c, t*y*z - s*x},
+		{t*x*z - s*y, t*y*z + s*x, t*z*z + c},
+	}
+}
+
+// RPY is the rotation of roll around x, then pitch around y, then yaw around z
+func RPY(roll, pitch, yaw float64) Mat3 {
+	return Rotation(Vec3{0, 0, 1}, yaw).Mul(Rotation(Vec3{0, 1, 0}, pitch)).Mul(Rotation(Vec3{1, 0, 0}, roll))
+}
+
+// Mul is the rotation n followed by m
+func (m Mat3) Mul(n Mat3) Mat3 {
+	var r Mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				r[i][j] += m[i][k] * n[k][j]
+			}
+		}
+	}
+	return r
+}
+
+// Apply rotates v
+func (m Mat3) Apply(v Vec3) Vec3 {
+	return Vec3{
+		m[0][0]*v[0] + m[0][1]*v[1] + m[0][2]*v[2],
+		m[1][0]*v[0] + m[1][1]*v[1] + m[1][2]*v[2],
+		m[2][0]*v[0] + m[2][1]*v[1] + m[2][2]*v[2],
+	}
+}
+
+// Transpose is the inverse of a rotation
+func (m Mat3) Transpose() Mat3 {
+	var r Mat3
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r[i][j] = m[j][i]
+		}
+	}
+	return r
+}
+
+// Log is the rotation vector of m, its direction is the axis and its length the angle
+func (m Mat3) Log() Vec3 {
+	cos := (m[0][0] + m[1][1] + m[2][2] - 1) / 2
+	cos = math.Max(-1, math.Min(1, cos))
+	angle := math.Acos(cos)
+	v := Vec3{m[2][1] - m[1][2], m[0][2] - m[2][0], m[1][0] - m[0][1]}
+	if angle < 1e-9 {
+		return v.Scale(0.5)
+	}
+	if math.Pi-angle < 1e-6 {
+		// near half a turn the skew part vanishes, take the axis from the diagonal
+		axis := Vec3{
+			math.Sqrt(math.Max(0, (m[0][0]+1)/2)),
+			math.Sqrt(math.Max(0, (m[1][1]+1)/2)),
+			math.Sqrt(math.Max(0, (m[2][2]+1)/2)),
+		}
+		if m[0][1] < 0 {
+			axis[1] = -axis[1]
+		}
+		if m[0][2] < 0 {
+			axis[2] = -axis[2]
+		}
+		return axis.Scale(angle)
+	}
+	return v.Scale(angle / (2 * math.Sin(angle)))
+}
+
+// Transform is a rotation followed by a translation
+type Transform struct {
+	R Mat3 `json:"rotation"`
+	P Vec3 `json:"position"`
+}
+
+// Origin is the transform that does nothing
+func Origin() Transform {
+	return Transform{R: Identity()}
+}
+
+// Mul is t followed by u in the frame of t
+func (t Transform) Mul(u Transform) Transform {
+	return Transform{R: t.R.Mul(u.R), P: t.P.Add(t.R.Apply(u.P))}
+}
+
+// Apply maps a point of the frame of t into the parent frame
+func (t Transform) Apply(v Vec3) Vec3 {
+	return t.P.Add(t.R.Apply(v))
+}
+
+// Inverse maps points of the parent frame back into the frame of t
+func (t Transform) Inverse() Transform {
+	r := t.R.Transpose()
+	return Transform{R: r, P: r.Apply(t.P).Scale(-1)}
+}
@@ -0,0 +1,267 @@
+package kinematics
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/robot"
+	"math"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PositionsPerRadian converts servo positions to joint angles, a Kondo servo
+// turns 135 degrees for 4000 positions from Neutral
+const PositionsPerRadian = 4000 / (135 * math.Pi / 180)
+
+//go:embed khr-3hv.yaml
+var defaultModel []byte
+
+// Model is the link tree of a robot, links are listed parents first
+type Model struct {
+	Name      string   `yaml:"name"`
+	Base      string   `yaml:"base"`
+	Effectors []string `yaml:"effectors"`
+	// BaseMass and BaseCOM are the mass properties of the base link
+	BaseMass float64 `yaml:"base-mass,omitempty"`
+	BaseCOM  Vec3    `yaml:"base-com,omitempty,flow"`
+	Links    []Link  `yaml:"links"`
+	// Soles are the feet the robot stands on
+	Soles []Sole `yaml:"soles,omitempty"`
+	// Capsules are the collision shapes, a link and its parent and
+	// pairs in CollisionIgnore never collide
+	Capsules        []Capsule   `yaml:"capsules,omitempty"`
+	CollisionIgnore [][2]string `yaml:"collision-ignore,omitempty,flow"`
+}
+
+// Link is a rigid body placed at Origin in its parent frame, turned around Axis
+// by the angle of Joint. A link without a joint is fixed to its parent.
+type Link struct {
+	Name   string `yaml:"name"`
+	Parent string `yaml:"parent"`
+	Joint  string `yaml:"joint,omitempty"`
+	Origin Vec3   `yaml:"origin,flow"`
+	Axis   Vec3   `yaml:"axis,omitempty,flow"`
+	// Mass is in grams, COM is its center in the link frame
+	Mass float64 `yaml:"mass,omitempty"`
+	COM  Vec3    `yaml:"com,omitempty,flow"`
+
+	kind khr_3hv.Kind
+}
+
+// LoadModel parses and validates a model
+func LoadModel(data []byte) (*Model, error) {
+	m := &Model{}
+	if err := yaml.UnmarshalStrict(data, m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadModelFile loads a model file
+func LoadModelFile(path string) (*Model, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m, err := LoadModel(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// DefaultModel is the model of a stock KHR-3HV
+func DefaultModel() *Model {
+	m, err := LoadModel(defaultModel)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Marshal encodes the model in the format LoadModel reads
+func (m *Model) Marshal() ([]byte, error) {
+	return yaml.Marshal(m)
+}
+
+// Validate checks that the links form a tree from Base, that every joint
+// is a KHR-3HV joint used once and that every axis is a unit vector
+func (m *Model) Validate() error {
+	if m.Base == "" {
+		return errors.New("model base should not be empty")
+	}
+	known := map[string]bool{m.Base: true}
+	joints := map[khr_3hv.Kind]string{}
+	for i := range m.Links {
+		l := &m.Links[i]
+		if l.Name == "" || known[l.Name] {
+			return fmt.Errorf("link %q should have a unique name", l.Name)
+		}
+		if !known[l.Parent] {
+			return fmt.Errorf("link %s: parent %q should be listed before it", l.Name, l.Parent)
+		}
+		known[l.Name] = true
+		if l.Joint == "" {
+			continue
+		}
+		kind, err := khr_3hv.ParseKind(l.Joint)
+		if err != nil {
+			return fmt.Errorf("link %s: %w", l.Name, err)
+		}
+		if other, ok := joints[kind]; ok {
+			return fmt.Errorf("link %s: joint %s already moves %s", l.Name, kind, other)
+		}
+		joints[kind] = l.Name
+		if math.Abs(l.Axis.Norm()-1) > 1e-9 {
+			return fmt.Errorf("link %s: axis %v should be a unit vector", l.Name, l.Axis)
+		}
+		l.kind = kind
+	}
+	for _, name := range m.Effectors {
+		if !known[name] {
+			return fmt.Errorf("effector %s is not a link", name)
+		}
+	}
+	if m.BaseMass < 0 {
+		return errors.New("base mass should not be negative")
+	}
+	for _, l := range m.Links {
+		if l.Mass < 0 {
+			return fmt.Errorf("link %s mass should not be negative", l.Name)
+		}
+	}
+	for _, sole := range m.Soles {
+		if !known[sole.Link] {
+			return fmt.Errorf("sole %s is not a link", sole.Link)
+		}
+		if sole.Length <= 0 || sole.Width <= 0 {
+			return fmt.Errorf("sole %s should have a size", sole.Link)
+		}
+	}
+	for _, c := range m.Capsules {
+		if !known[c.Link] {
+			return fmt.Errorf("capsule %s is not a link", c.Link)
+		}
+		if c.Radius <= 0 {
+			return fmt.Errorf("capsule %s radius should be positive", c.Link)
+		}
+	}
+	for _, pair := range m.CollisionIgnore {
+		for _, name := range pair {
+			if !known[name] {
+				return fmt.Errorf("collision ignore %s is not a link", name)
+			}
+		}
+	}
+	return nil
+}
+
+// Link finds a link by name
+func (m *Model) Link(name string) (Link, bool) {
+	for _, l := range m.Links {
+		if l.Name == name {
+			return l, true
+		}
+	}
+	return Link{}, false
+}
+
+// Forward is the transform of every link frame in the base frame,
+// a joint missing in angles is at zero
+func (m *Model) Forward(angles map[khr_3hv.Kind]float64) map[string]Transform {
+	frames := make(map[string]Transform, len(m.Links)+1)
+	frames[m.Base] = Origin()
+	for _, l := range m.Links {
+		local := Transform{R: Identity(), P: l.Origin}
+		if l.Joint != "" {
+			local.R = Rotation(l.Axis, angles[l.kind])
+		}
+		frames[l.Name] = frames[l.Parent].Mul(local)
+	}
+	return frames
+}
+
+// EffectorFrames are the frames of the effector links
+func (m *Model) EffectorFrames(angles map[khr_3hv.Kind]float64) map[string]Transform {
+	frames := m.Forward(angles)
+	effectors := make(map[string]Transform, len(m.Effectors))
+	for _, name := range m.Effectors {
+		effectors[name] = frames[name]
+	}
+	return effectors
+}
+
+// Calibration is the robot description of every joint, it converts servo positions to angles
+type Calibration map[khr_3hv.Kind]robot.Joint
+
+// NewCalibration takes the joints of a robot description
+func NewCalibration(desc *robot.Robot) (Calibration, error) {
+	c := Calibration{}
+	for _, j := range desc.Joints {
+		kind, err := khr_3hv.ParseKind(j.Name)
+		if err != nil {
+			return nil, err
+		}
+		c[kind] = j
+	}
+	return c, nil
+}
+
+// DefaultCalibration is the calibration of the stock KHR-3HV description
+func DefaultCalibration() Calibration {
+	c, err := NewCalibration(khr_3hv.DefaultDescription())
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// WithLimits is a copy of c whose joint limits are the effective limits of the
+// motors, the described limits tightened by the EEPROM pulse limits once LoadLimits read them
+func (c Calibration) WithLimits(r *khr_3hv.RobotNum) Calibration {
+	limited := make(Calibration, len(c))
+	for kind, j := range c {
+		if kind.Valid() {
+			j.Limits.Min, j.Limits.Max = r[kind].Limits()
+		}
+		limited[kind] = j
+	}
+	return limited
+}
+
+// Angles converts every position of the pose to radians from the calibrated zero
+func (c Calibration) Angles(p khr_3hv.Pose) map[khr_3hv.Kind]float64 {
+	angles := make(map[khr_3hv.Kind]float64, len(p.Positions))
+	for kind, position := range p.Positions {
+		angles[kind] = float64(khr_3hv.Angle(c.joint(kind), position)) / PositionsPerRadian
+	}
+	return angles
+}
+
+// Pose converts angles in radians back to servo positions, clamped to the servo range
+func (c Calibration) Pose(name string, angles map[khr_3hv.Kind]float64) khr_3hv.Pose {
+	p := khr_3hv.Pose{Name: name, Positions: make(map[khr_3hv.Kind]uint, len(angles))}
+	for kind, angle := range angles {
+		p.Positions[kind] = khr_3hv.PositionOf(c.joint(kind), int(math.Round(angle*PositionsPerRadian)))
+	}
+	return p
+}
+
+// joint is the calibration of kind, an undescribed joint is straight at Neutral
+func (c Calibration) joint(kind khr_3hv.Kind) robot.Joint {
+	if j, ok := c[kind]; ok {
+		return j
+	}
+	return robot.Joint{Direction: 1}
+}
+
+// ForwardPose is Forward of a pose of servo positions
+func (m *Model) ForwardPose(c Calibration, p khr_3hv.Pose) map[string]Transform {
+	return m.Forward(c.Angles(p))
+}
@@ -0,0 +1,73 @@
+package kinematics
+
+import (
+	"kondocontrol/internal/khr_3hv"
+	"math"
+	"strings"
+	"testing"
+)
+
+func near(a, b Vec3) bool {
+	return a.Sub(b).Norm() < 1e-6
+}
+
+func TestForward(t *testing.T) {
+	m := DefaultModel()
+	frames := m.Forward(nil)
+	if foot := frames["LeftFoot"].P; !near(foot, Vec3{0, 24, -230}) {
+		t.Errorf("straight left foot should be at (0, 24, -230), but actual %v", foot)
+	}
+	if hand := frames["RightHand"].P; !near(hand, Vec3{0, -84, -62}) {
+		t.Errorf("straight right hand should be at (0, -84, -62), but actual %v", hand)
+	}
+
+	// bend the knee a right angle, the shin points backwards
+	frames = m.Forward(map[khr_3hv.Kind]float64{khr_3hv.LeftKnee: math.Pi / 2})
+	if foot := frames["LeftFoot"].P; !near(foot, Vec3{-107, 24, -123}) {
+		t.Errorf("left foot should be at (-107, 24, -123), but actual %v", foot)
+	}
+	// turning the waist swings the arms but not the legs
+	frames = m.Forward(map[khr_3hv.Kind]float64{khr_3hv.Waist: math.Pi / 2})
+	if hand := frames["LeftHand"].P; !near(hand, Vec3{-84, 0, -62}) {
+		t.Errorf("left hand should be at (-84, 0, -62), but actual %v", hand)
+	}
+	if foot := frames["RightFoot"].P; !near(foot, Vec3{0, -24, -230}) {
+		t.Errorf("right foot should not move, but actual %v", foot)
+	}
+}
+
+func TestCalibration(t *testing.T) {
+	c := DefaultCalibration()
+	j := c[khr_3hv.LeftKnee]
+	j.Direction, j.ZeroOffset = -1, 200
+	c[khr_3hv.LeftKnee] = j
+
+	p := khr_3hv.NewPose("", map[khr_3hv.Kind]uint{khr_3hv.LeftKnee: 7700, khr_3hv.RightKnee: 11500})
+	angles := c.Angles(p)
+	if angles[khr_3hv.LeftKnee] != 0 {
+		t.Errorf("LeftKnee at its offset should be straight, actual %v", angles[khr_3hv.LeftKnee])
+	}
+	if math.Abs(angles[khr_3hv.RightKnee]-135*math.Pi/180) > 1e-9 {
+		t.Errorf("RightKnee at 11500 should be 135 degrees, actual %v", angles[khr_3hv.RightKnee])
+	}
+	back := c.Pose("", angles)
+	if back.Positions[khr_3hv.LeftKnee] != 7700 || back.Positions[khr_3hv.RightKnee] != 11500 {
+		t.Errorf("Pose should invert Angles, actual %v", back.Positions)
+	}
+}
+
+func TestModelValidate(t *testing.T) {
+	cases := map[string]string{
+		"parent order":   strings.Replace(string(defaultModel), "parent: Neck", "parent: Face", 1),
+		"joint twice":    strings.Replace(string(defaultModel), "joint: Head", "joint: Waist", 1),
+		"unknown joint":  strings.Replace(string(defaultModel), "joint: Head", "joint: Neck", 1),
+		"axis":           strings.Replace(string(defaultModel), "axis: [0, 0, 1]}", "axis: [0, 0, 2]}", 1),
+		"effector":       strings.Replace(string(defaultModel), "LeftHand, RightHand", "LeftPaw, RightHand", 1),
+		"duplicate link": strings.Replace(string(defaultModel), "name: Neck", "name: Chest", 1),
+	}
+	for name, data := range cases {
+		if _, err := LoadModel([]byte(data)); err == nil {
+			t.Errorf("%s: LoadModel should fail", name)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package kinematics
+
+import (
+	"errors"
+	"kondocontrol/internal/khr_3hv"
+	"math"
+	"sort"
+	"time"
+)
+
+// Sole is a rectangular foot centered on the origin of its link, length along x
+type Sole struct {
+	Link   string  `yaml:"link"`
+	Length float64 `yaml:"length"`
+	Width  float64 `yaml:"width"`
+}
+
+// ContactTolerance is how far above the lowest sole another sole still touches the ground, in mm
+const ContactTolerance = 2.0
+
+// Stability is the static balance of a pose, with the base upright and the lowest sole on the ground
+type Stability struct {
+	CenterOfMass Vec3 `json:"center-of-mass"`
+	// Mass is in grams
+	Mass     float64  `json:"mass"`
+	Contacts []string `json:"contacts"`
+	// Support is the support polygon on the ground, counter-clockwise
+	Support [][2]float64 `json:"support"`
+	// Margin is the distance from the projected center of mass to the nearest
+	// edge of Support, negative when it is outside
+	Margin float64 `json:"margin"`
+	Stable bool    `json:"stable"`
+}
+
+// CenterOfMass is the whole-body center of mass in the base frame and the total mass
+func (m *Model) CenterOfMass(angles map[khr_3hv.Kind]float64) (Vec3, float64) {
+	frames := m.Forward(angles)
+	sum, mass := m.BaseCOM.Scale(m.BaseMass), m.BaseMass
+	for _, l := range m.Links {
+		sum = sum.Add(frames[l.Name].Apply(l.COM).Scale(l.Mass))
+		mass += l.Mass
+	}
+	if mass == 0 {
+		return Vec3{}, 0
+	}
+	return sum.Scale(1 / mass), mass
+}
+
+// Stability checks whether the ground projection of the center of mass falls inside
+// the support polygon of the soles in contact. Gravity is taken along -z of the base.
+func (m *Model) Stability(angles map[khr_3hv.Kind]float64) (Stability, error) {
+	if len(m.Soles) == 0 {
+		return Stability{}, errors.New("model has no sole to stand on")
+	}
+	frames := m.Forward(angles)
+	com, mass := m.CenterOfMass(angles)
+	s := Stability{CenterOfMass: com, Mass: mass}
+
+	ground := math.Inf(1)
+	for _, sole := range m.Soles {
+		ground = math.Min(ground, frames[sole.Link].P[2])
+	}
+	var corners [][2]float64
+	for _, sole := range m.Soles {
+		frame := frames[sole.Link]
+		if frame.P[2] > ground+ContactTolerance {
+			continue
+		}
+		s.Contacts = append(s.Contacts, sole.Link)
+		for _, x := range []float64{-sole.Length / 2, sole.Length / 2} {
+			for _, y := range []float64{-sole.Width / 2, sole.Width / 2} {
+				c := frame.Apply(Vec3{x, y, 0})
+				corners = append(corners, [2]float64{c[0], c[1]})
+			}
+		}
+	}
+	s.Support = convexHull(corners)
+	s.Margin = margin(s.Support, [2]float64{com[0], com[1]})
+	s.Stable = s.Margin > 0
+	return s, nil
+}
+
+// Instability is a keyframe of a motion that would tip over
+type Instability struct {
+	Index     int           `json:"index"`
+	Time      time.Duration `json:"time"`
+	Stability Stability     `json:"stability"`
+}
+
+// CheckMotion flags every keyframe whose pose is statically unstable,
+// joints missing in a keyframe are taken interpolated from the motion
+func (m *Model) CheckMotion(c Calibration, motion khr_3hv.Motion) ([]Instability, error) {
+	var unstable []Instability
+	for i, k := range motion.Keyframes {
+		s, err := m.Stability(c.Angles(motion.At(k.Time)))
+		if err != nil {
+			return nil, err
+		}
+		if !s.Stable {
+			unstable = append(unstable, Instability{Index: i, Time: k.Time, Stability: s})
+		}
+	}
+	return unstable, nil
+}
+
+// convexHull is the counter-clockwise hull of points, Andrew's monotone chain
+func convexHull(points [][2]float64) [][2]float64 {
+	if len(points) < 3 {
+		return points
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i][0] != points[j][0] {
+			return points[i][0] < points[j][0]
+		}
+		return points[i][1] < points[j][1]
+	})
+	cross := func(o, a, b [2]float64) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	hull := make([][2]float64, 0, 2*len(points))
+	for _, p := range points {
+		for len(hull) >= 2 && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	for i, lower := len(points)-2, len(hull)+1; i >= 0; i-- {
+		p := points[i]
+		for len(hull) >= lower && cross(hull[len(hull)-2], hull[len(hull)-1], p) <= 0 {
+			hull = hull[:len(hull)-1]
+		}
+		hull = append(hull, p)
+	}
+	return hull[:len(hull)-1]
+}
+
+// margin is the signed distance from p to the nearest edge of a counter-clockwise polygon
+func margin(polygon [][2]float64, p [2]float64) float64 {
+	if len(polygon) < 3 {
+		return math.Inf(-1)
+	}
+	inside, outside := math.Inf(1), math.Inf(1)
+	for i := range polygon {
+		a, b := polygon[i], polygon[(i+1)%len(polygon)]
+		ex, ey := b[0]-a[0], b[1]-a[1]
+		length := math.Hypot(ex, ey)
+		// distance to the edge line, positive on the inner side
+		inside = math.Min(inside, (ex*(p[1]-a[1])-ey*(p[0]-a[0]))/length)
+		// distance to the edge itself, the nearest one is the distance from outside
+		t := math.Max(0, math.Min(1, ((p[0]-a[0])*ex+(p[1]-a[1])*ey)/(length*length)))
+		outside = math.Min(outside, math.Hypot(p[0]-a[0]-t*ex, p[1]-a[1]-t*ey))
+	}
+	if inside >= 0 {
+		return inside
+	}
+	return -outside
+}
@@ -0,0 +1,73 @@
+package kinematics
+
+import (
+	"kondocontrol/internal/khr_3hv"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestCenterOfMass(t *testing.T) {
+	m := DefaultModel()
+	com, mass := m.CenterOfMass(nil)
+	if mass != 1550 {
+		t.Errorf("KHR-3HV should weigh 1550 g, but actual %v", mass)
+	}
+	if math.Abs(com[0]) > 1e-9 || math.Abs(com[1]) > 1e-9 {
+		t.Errorf("a straight robot is balanced on its middle, actual %v", com)
+	}
+	// both arms forward move the center of mass forward
+	forward, _ := m.CenterOfMass(map[khr_3hv.Kind]float64{khr_3hv.LeftShoulderPitch: -math.Pi / 2, khr_3hv.RightShoulderPitch: -math.Pi / 2})
+	if forward[0] <= 1 {
+		t.Errorf("arms forward should move the center of mass forward, actual %v", forward)
+	}
+}
+
+func TestStability(t *testing.T) {
+	m := DefaultModel()
+	s, err := m.Stability(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Stable || len(s.Contacts) != 2 || len(s.Support) != 4 {
+		t.Errorf("standing on both feet should be stable, actual %+v", s)
+	}
+	if math.Abs(s.Margin-50) > 1e-6 {
+		t.Errorf("margin should be half the sole length, actual %v", s.Margin)
+	}
+
+	// the lifted foot no longer supports, the center of mass is just inside the right sole
+	lift := map[khr_3hv.Kind]float64{khr_3hv.LeftHipPitch: -0.5, khr_3hv.LeftKnee: 1, khr_3hv.LeftAnklePitch: -0.5}
+	s, _ = m.Stability(lift)
+	if !s.Stable || len(s.Contacts) != 1 || s.Contacts[0] != "RightFoot" {
+		t.Errorf("standing on the right foot should be stable, actual %+v", s)
+	}
+	if math.Abs(s.Margin-6) > 1e-6 {
+		t.Errorf("margin should be the inner half of the right sole, actual %v", s.Margin)
+	}
+
+	// swinging the lifted leg out tips the robot over
+	lift[khr_3hv.LeftHipRoll] = 0.8
+	s, _ = m.Stability(lift)
+	if s.Stable || s.Margin >= 0 {
+		t.Errorf("swinging the lifted leg out should be unstable, actual %+v", s)
+	}
+}
+
+func TestCheckMotion(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	straight := c.Pose("straight", map[khr_3hv.Kind]float64{khr_3hv.LeftHipPitch: 0, khr_3hv.LeftKnee: 0, khr_3hv.LeftAnklePitch: 0, khr_3hv.LeftHipRoll: 0})
+	swing := c.Pose("swing", map[khr_3hv.Kind]float64{khr_3hv.LeftHipPitch: -0.5, khr_3hv.LeftKnee: 1, khr_3hv.LeftAnklePitch: -0.5, khr_3hv.LeftHipRoll: 0.8})
+	motion := khr_3hv.Motion{Name: "swing", Keyframes: []khr_3hv.Keyframe{
+		{Time: 0, Pose: straight},
+		{Time: time.Second, Pose: swing},
+		{Time: 2 * time.Second, Pose: straight},
+	}}
+	unstable, err := m.CheckMotion(c, motion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unstable) != 1 || unstable[0].Index != 1 || unstable[0].Time != time.Second {
+		t.Errorf("only the lifted keyframe should be flagged, actual %+v", unstable)
+	}
+}
@@ -0,0 +1,281 @@
+package kinematics
+
+import (
+	"encoding/xml"
+	"fmt"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/robot"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// URDF joints carry the rating of the KRS-2552RHV servo of the KHR-3HV,
+// 14 kgf·cm and 0.14 s per 60 degrees
+const (
+	URDFEffort   = 1.37 // N·m
+	URDFVelocity = 7.48 // rad/s
+)
+
+// urdfInertiaRadius is the radius in mm of the solid sphere a link's inertia is estimated with,
+// the model has masses but no inertia
+const urdfInertiaRadius = 20.0
+
+type urdfRobot struct {
+	XMLName xml.Name    `xml:"robot"`
+	Name    string      `xml:"name,attr"`
+	Links   []urdfLink  `xml:"link"`
+	Joints  []urdfJoint `xml:"joint"`
+}
+
+type urdfLink struct {
+	Name      string         `xml:"name,attr"`
+	Inertial  *urdfInertial  `xml:"inertial,omitempty"`
+	Visual    []urdfGeometry `xml:"visual"`
+	Collision []urdfGeometry `xml:"collision"`
+}
+
+type urdfInertial struct {
+	Origin  urdfOrigin `xml:"origin"`
+	Mass    urdfValue  `xml:"mass"`
+	Inertia struct {
+		IXX float64 `xml:"ixx,attr"`
+		IXY float64 `xml:"ixy,attr"`
+		IXZ float64 `xml:"ixz,attr"`
+		IYY float64 `xml:"iyy,attr"`
+		IYZ float64 `xml:"iyz,attr"`
+		IZZ float64 `xml:"izz,attr"`
+	} `xml:"inertia"`
+}
+
+type urdfGeometry struct {
+	Origin   urdfOrigin `xml:"origin"`
+	Geometry struct {
+		Cylinder struct {
+			Radius float64 `xml:"radius,attr"`
+			Length float64 `xml:"length,attr"`
+		} `xml:"cylinder"`
+	} `xml:"geometry"`
+}
+
+type urdfJoint struct {
+	Name   string     `xml:"name,attr"`
+	Type   string     `xml:"type,attr"`
+	Parent urdfRef    `xml:"parent"`
+	Child  urdfRef    `xml:"child"`
+	Origin urdfOrigin `xml:"origin"`
+	Axis   *struct {
+		XYZ string `xml:"xyz,attr"`
+	} `xml:"axis,omitempty"`
+	Limit *struct {
+		Lower    float64 `xml:"lower,attr"`
+		Upper    float64 `xml:"upper,attr"`
+		Effort   float64 `xml:"effort,attr"`
+		Velocity float64 `xml:"velocity,attr"`
+	} `xml:"limit,omitempty"`
+}
+
+type urdfRef struct {
+	Link string `xml:"link,attr"`
+}
+
+type urdfValue struct {
+	Value float64 `xml:"value,attr"`
+}
+
+// urdfOrigin is a pose in metres and radians, both are "x y z"
+type urdfOrigin struct {
+	XYZ string `xml:"xyz,attr,omitempty"`
+	RPY string `xml:"rpy,attr,omitempty"`
+}
+
+// URDF generates a URDF document of the model in metres and kilograms. The joints are
+// named by their Kind and limited to limits, servo positions by joint, or the servo
+// range when a joint is missing. Capsules become cylinders to look at and collide with.
+func (m *Model) URDF(c Calibration, limits map[khr_3hv.Kind][2]uint) ([]byte, error) {
+	doc := urdfRobot{Name: m.Name}
+	shapes := map[string][]urdfGeometry{}
+	for _, capsule := range m.Capsules {
+		shapes[capsule.Link] = append(shapes[capsule.Link], capsule.urdf())
+	}
+	doc.Links = append(doc.Links, urdfLink{Name: m.Base, Inertial: inertial(m.BaseMass, m.BaseCOM), Visual: shapes[m.Base], Collision: shapes[m.Base]})
+	for _, l := range m.Links {
+		doc.Links = append(doc.Links, urdfLink{Name: l.Name, Inertial: inertial(l.Mass, l.COM), Visual: shapes[l.Name], Collision: shapes[l.Name]})
+		j := urdfJoint{
+			Name:   l.Parent + "_" + l.Name,
+			Type:   "fixed",
+			Parent: urdfRef{l.Parent},
+			Child:  urdfRef{l.Name},
+			Origin: urdfOrigin{XYZ: xyz(l.Origin.Scale(0.001))},
+		}
+		if l.Joint != "" {
+			j.Name, j.Type = l.kind.String(), "revolute"
+			j.Axis = &struct {
+				XYZ string `xml:"xyz,attr"`
+			}{xyz(l.Axis)}
+			min, max := robot.MinimumPosition, robot.MaximumPosition
+			if limit, ok := limits[l.kind]; ok {
+				min, max = limit[0], limit[1]
+			}
+			lower, upper := c.angle(l.kind, min), c.angle(l.kind, max)
+			j.Limit = &struct {
+				Lower    float64 `xml:"lower,attr"`
+				Upper    float64 `xml:"upper,attr"`
+				Effort   float64 `xml:"effort,attr"`
+				Velocity float64 `xml:"velocity,attr"`
+			}{math.Min(lower, upper), math.Max(lower, upper), URDFEffort, URDFVelocity}
+		}
+		doc.Joints = append(doc.Joints, j)
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// angle is the joint angle of a servo position in radians
+func (c Calibration) angle(kind khr_3hv.Kind, position uint) float64 {
+	return float64(khr_3hv.Angle(c.joint(kind), position)) / PositionsPerRadian
+}
+
+func inertial(mass float64, com Vec3) *urdfInertial {
+	if mass == 0 {
+		return nil
+	}
+	in := &urdfInertial{Origin: urdfOrigin{XYZ: xyz(com.Scale(0.001))}, Mass: urdfValue{mass / 1000}}
+	i := 0.4 * mass / 1000 * math.Pow(urdfInertiaRadius/1000, 2)
+	in.Inertia.IXX, in.Inertia.IYY, in.Inertia.IZZ = i, i, i
+	return in
+}
+
+// urdf is the cylinder between the ends of the capsule, turned from z onto the segment
+func (c Capsule) urdf() urdfGeometry {
+	d := c.To.Sub(c.From)
+	g := urdfGeometry{Origin: urdfOrigin{
+		XYZ: xyz(c.From.Add(d.Scale(0.5)).Scale(0.001)),
+		RPY: xyz(Vec3{0, math.Atan2(math.Hypot(d[0], d[1]), d[2]), math.Atan2(d[1], d[0])}),
+	}}
+	g.Geometry.Cylinder.Radius = c.Radius / 1000
+	g.Geometry.Cylinder.Length = d.Norm() / 1000
+	return g
+}
+
+func xyz(v Vec3) string {
+	s := make([]string, len(v))
+	for i, f := range v {
+		s[i] = strconv.FormatFloat(f, 'g', 6, 64)
+	}
+	return strings.Join(s, " ")
+}
+
+func parseXYZ(s string) (Vec3, error) {
+	var v Vec3
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return v, nil
+	}
+	if len(fields) != 3 {
+		return v, fmt.Errorf("%q should be three numbers", s)
+	}
+	for i, f := range fields {
+		var err error
+		if v[i], err = strconv.ParseFloat(f, 64); err != nil {
+			return v, fmt.Errorf("%q should be three numbers", s)
+		}
+	}
+	return v, nil
+}
+
+// ImportURDF reads the joint origins of a URDF document into the links of the model,
+// matched by the name of the child link, and returns the joint limits in radians of
+// every revolute joint that moves a link of the model. URDF links the model doesn't
+// have are skipped. A joint must have the parent and, when it moves a link of the model,
+// the axis of the model, a joint origin that turns its frame can't be imported.
+// The model is left as it was on an error.
+func (m *Model) ImportURDF(data []byte) (map[khr_3hv.Kind][2]float64, error) {
+	var doc urdfRobot
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("[ImportURDF] %w", err)
+	}
+	links := append([]Link{}, m.Links...)
+	index := make(map[string]int, len(links))
+	for i, l := range links {
+		index[l.Name] = i
+	}
+	limits := map[khr_3hv.Kind][2]float64{}
+	for _, j := range doc.Joints {
+		i, ok := index[j.Child.Link]
+		if !ok {
+			continue
+		}
+		l := &links[i]
+		if j.Parent.Link != l.Parent {
+			return nil, fmt.Errorf("[ImportURDF] joint %s hangs %s from %s, but the model from %s", j.Name, l.Name, j.Parent.Link, l.Parent)
+		}
+		rpy, err := parseXYZ(j.Origin.RPY)
+		if err != nil {
+			return nil, fmt.Errorf("[ImportURDF] joint %s rpy %w", j.Name, err)
+		}
+		if rpy != (Vec3{}) {
+			return nil, fmt.Errorf("[ImportURDF] joint %s turns the frame of %s, only translated origins can be imported", j.Name, l.Name)
+		}
+		if l.Joint != "" {
+			if err := j.checkAxis(l.Axis); err != nil {
+				return nil, fmt.Errorf("[ImportURDF] joint %s of %s: %w", j.Name, l.Name, err)
+			}
+		}
+		origin, err := parseXYZ(j.Origin.XYZ)
+		if err != nil {
+			return nil, fmt.Errorf("[ImportURDF] joint %s xyz %w", j.Name, err)
+		}
+		l.Origin = origin.Scale(1000)
+		if l.Joint != "" && j.Limit != nil && j.Type == "revolute" {
+			limits[l.kind] = [2]float64{j.Limit.Lower, j.Limit.Upper}
+		}
+	}
+	m.Links = links
+	return limits, nil
+}
+
+// checkAxis reports whether the joint turns around axis like a joint of the model,
+// a URDF joint without an axis turns around x
+func (j urdfJoint) checkAxis(axis Vec3) error {
+	if j.Type != "revolute" && j.Type != "continuous" {
+		return fmt.Errorf("type should be revolute or continuous, but actual %s", j.Type)
+	}
+	a := Vec3{1, 0, 0}
+	if j.Axis != nil {
+		var err error
+		if a, err = parseXYZ(j.Axis.XYZ); err != nil {
+			return fmt.Errorf("axis %w", err)
+		}
+	}
+	if n := a.Norm(); n == 0 || a.Scale(1/n).Sub(axis).Norm() > 1e-6 {
+		return fmt.Errorf("axis %v should be %v", a, axis)
+	}
+	return nil
+}
+
+// ApplyLimits sets the soft limits of the described joints to ranges in radians,
+// the limit mode of a joint is kept
+func (c Calibration) ApplyLimits(desc *robot.Robot, ranges map[khr_3hv.Kind][2]float64) error {
+	for i, j := range desc.Joints {
+		kind, err := khr_3hv.ParseKind(j.Name)
+		if err != nil {
+			return err
+		}
+		r, ok := ranges[kind]
+		if !ok {
+			continue
+		}
+		p := c.Pose("", map[khr_3hv.Kind]float64{kind: r[0]}).Positions[kind]
+		q := c.Pose("", map[khr_3hv.Kind]float64{kind: r[1]}).Positions[kind]
+		if p > q {
+			p, q = q, p
+		}
+		desc.Joints[i].Limits.Min, desc.Joints[i].Limits.Max = p, q
+		c[kind] = desc.Joints[i]
+	}
+	return desc.Validate()
+}
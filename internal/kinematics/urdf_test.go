@@ -0,0 +1,137 @@
+package kinematics
+
+import (
+	"encoding/xml"
+	"kondocontrol/internal/khr_3hv"
+	"kondocontrol/internal/robot"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestURDF(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	data, err := m.URDF(c, map[khr_3hv.Kind][2]uint{khr_3hv.LeftKnee: {7500, 11500}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc urdfRobot
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Links) != len(m.Links)+1 || len(doc.Joints) != len(m.Links) {
+		t.Fatalf("every link should have a URDF link and joint, actual %d links and %d joints", len(doc.Links), len(doc.Joints))
+	}
+	var revolute int
+	for _, j := range doc.Joints {
+		if j.Type == "revolute" {
+			revolute++
+		}
+		if j.Name != "LeftKnee" {
+			continue
+		}
+		if j.Parent.Link != "LeftThigh" || j.Child.Link != "LeftShin" || j.Origin.XYZ != "0 0 -0.075" || j.Axis.XYZ != "0 1 0" {
+			t.Errorf("LeftKnee should join LeftThigh to LeftShin 75 mm down around y, actual %+v", j)
+		}
+		if j.Limit.Lower != 0 || math.Abs(j.Limit.Upper-4000/PositionsPerRadian) > 1e-9 {
+			t.Errorf("LeftKnee should be limited to 0-135 degrees, actual %+v", j.Limit)
+		}
+	}
+	if revolute != len(khr_3hv.Kinds()) {
+		t.Errorf("every KHR-3HV joint should be revolute, actual %d", revolute)
+	}
+	if !strings.Contains(string(data), `<mass value="0.4"></mass>`) {
+		t.Errorf("chest mass should be 0.4 kg\n%s", data)
+	}
+}
+
+func TestImportURDF(t *testing.T) {
+	m, c := DefaultModel(), DefaultCalibration()
+	data, err := m.URDF(c, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// longer shins in the URDF
+	data = []byte(strings.Replace(string(data), `<child link="LeftAnkle"></child>
+    <origin xyz="0 0 -0.075"></origin>`, `<child link="LeftAnkle"></child>
+    <origin xyz="0 0 -0.09"></origin>`, 1))
+
+	imported := DefaultModel()
+	limits, err := imported.ImportURDF(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ankle, _ := imported.Link("LeftAnkle")
+	if math.Abs(ankle.Origin[2]+90) > 1e-9 {
+		t.Errorf("LeftAnkle should be 90 mm below the knee, actual %v", ankle.Origin)
+	}
+	for i, l := range imported.Links {
+		if l.Name != "LeftAnkle" && !reflect.DeepEqual(l.Origin, m.Links[i].Origin) {
+			t.Errorf("%s origin should be kept, but actual %v", l.Name, l.Origin)
+		}
+	}
+	if len(limits) != len(khr_3hv.Kinds()) {
+		t.Errorf("every joint should have limits, actual %d", len(limits))
+	}
+
+	desc := khr_3hv.DefaultDescription()
+	limits[khr_3hv.LeftKnee] = [2]float64{0, math.Pi / 2}
+	if err := c.ApplyLimits(desc, limits); err != nil {
+		t.Fatal(err)
+	}
+	knee, _ := desc.Joint("LeftKnee")
+	want := robot.Neutral + uint(math.Round(math.Pi/2*PositionsPerRadian))
+	if knee.Limits.Min != robot.Neutral || knee.Limits.Max != want {
+		t.Errorf("LeftKnee should be limited to %d-%d, actual %+v", robot.Neutral, want, knee.Limits)
+	}
+}
+
+func TestImportURDFRotated(t *testing.T) {
+	doc := `<robot name="r"><joint name="j" type="fixed"><parent link="Pelvis"/><child link="Chest"/><origin xyz="0 0 0.03" rpy="0 0.1 0"/></joint></robot>`
+	if _, err := DefaultModel().ImportURDF([]byte(doc)); err == nil {
+		t.Error("a turned joint origin should not be imported")
+	}
+}
+
+func TestImportURDFMismatch(t *testing.T) {
+	data, err := DefaultModel().URDF(DefaultCalibration(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	knee := `<joint name="LeftKnee" type="revolute">
+    <parent link="LeftThigh"></parent>
+    <child link="LeftShin"></child>
+    <origin xyz="0 0 -0.075"></origin>
+    <axis xyz="0 1 0"></axis>`
+	if !strings.Contains(string(data), knee) {
+		t.Fatalf("URDF should have the knee joint %s", knee)
+	}
+	// the chest comes before the knee, its origin is read before the knee fails
+	chest := strings.Replace(string(data), `<child link="Chest"></child>
+    <origin xyz="0 0 0.03"></origin>`, `<child link="Chest"></child>
+    <origin xyz="0 0 0.04"></origin>`, 1)
+	cases := map[string]string{
+		"parent":     strings.Replace(knee, `<parent link="LeftThigh">`, `<parent link="LeftHipRoll">`, 1),
+		"axis":       strings.Replace(knee, `<axis xyz="0 1 0">`, `<axis xyz="1 0 0">`, 1),
+		"fixed type": strings.Replace(knee, `type="revolute"`, `type="fixed"`, 1),
+	}
+	for name, joint := range cases {
+		m := DefaultModel()
+		if _, err := m.ImportURDF([]byte(strings.Replace(chest, knee, joint, 1))); err == nil {
+			t.Errorf("a joint with a different %s should not be imported", name)
+		}
+		if !reflect.DeepEqual(m.Links, DefaultModel().Links) {
+			t.Errorf("%s: the model should be kept on an error", name)
+		}
+	}
+
+	continuous := strings.Replace(string(data), knee, strings.Replace(knee, `type="revolute"`, `type="continuous"`, 1), 1)
+	limits, err := DefaultModel().ImportURDF([]byte(continuous))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := limits[khr_3hv.LeftKnee]; ok {
+		t.Error("a continuous joint should have no limits")
+	}
+}
@@ -0,0 +1,190 @@
+package robot
+
+import (
+	_ "embed"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"kondocontrol/internal/eeprom"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Neutral is the servo position of a straight joint
+	Neutral uint = 7500
+	// MinimumPosition and MaximumPosition are what a Kondo servo accepts
+	MinimumPosition uint = 3500
+	MaximumPosition uint = 11500
+)
+
+// Robot describes a robot made of Kondo servos,
+// so that a kit or a modified build needs a file instead of code
+type Robot struct {
+	Name string `yaml:"name"`
+	// Servos are servo models the joints may use besides the known ones, see KnownServos
+	Servos []Servo `yaml:"servos,omitempty"`
+	Joints []Joint `yaml:"joints"`
+}
+
+// Servo is a servo model and the positions it accepts
+type Servo struct {
+	Model string `yaml:"model"`
+	Min   uint   `yaml:"min"`
+	Max   uint   `yaml:"max"`
+}
+
+//go:embed servos.yaml
+var knownServos []byte
+
+// KnownServos are the servo models every description may use
+func KnownServos() []Servo {
+	var servos []Servo
+	if err := yaml.UnmarshalStrict(knownServos, &servos); err != nil {
+		panic(err)
+	}
+	return servos
+}
+
+// Servo finds a servo model, declared ones first
+func (r *Robot) Servo(model string) (Servo, bool) {
+	for _, s := range append(append([]Servo{}, r.Servos...), KnownServos()...) {
+		if s.Model == model {
+			return s, true
+		}
+	}
+	return Servo{}, false
+}
+
+// Joint is one servo of the robot
+type Joint struct {
+	Name string `yaml:"name"`
+	// Port names the serial port the servo is on
+	Port string `yaml:"port"`
+	ID   uint8  `yaml:"id"`
+	// Model is the servo model, such as KRS-2552RHV
+	Model string `yaml:"model"`
+	// Direction is 1, or -1 when the servo is mounted reversed
+	Direction int `yaml:"direction"`
+	// ZeroOffset is added to Neutral to get the straight position of the joint
+	ZeroOffset int `yaml:"zero-offset"`
+	// Limits are soft limits, a zero value means no limit
+	Limits Limits `yaml:"limits,omitempty"`
+	// SignalSpeed is the baud rate the servo EEPROM should be set to, High, Mid or Low, not checked when empty
+	SignalSpeed string `yaml:"signal-speed,omitempty"`
+}
+
+// Limits is a range of servo positions
+type Limits struct {
+	Min uint `yaml:"min"`
+	Max uint `yaml:"max"`
+	// Mode is what happens to a command outside the range, clamp or reject, reject when empty
+	Mode string `yaml:"mode,omitempty"`
+}
+
+// Limit modes
+const (
+	Reject = "reject"
+	Clamp  = "clamp"
+)
+
+// Load parses and validates a robot description
+func Load(data []byte) (*Robot, error) {
+	r := &Robot{}
+	if err := yaml.UnmarshalStrict(data, r); err != nil {
+		return nil, err
+	}
+	if err := r.Validate(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadFile loads a robot description file
+func LoadFile(path string) (*Robot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := Load(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// Marshal encodes the description in the format Load reads
+func (r *Robot) Marshal() ([]byte, error) {
+	return yaml.Marshal(r)
+}
+
+// Validate checks that every servo is usable and every joint is unique and can be driven
+func (r *Robot) Validate() error {
+	if len(r.Joints) == 0 {
+		return errors.New("robot has no joint")
+	}
+	for _, s := range r.Servos {
+		if s.Model == "" {
+			return errors.New("servo model should not be empty")
+		}
+		if s.Min < MinimumPosition || s.Max > MaximumPosition || s.Min >= s.Max {
+			return fmt.Errorf("servo %s range %d-%d should be inside %d-%d", s.Model, s.Min, s.Max, MinimumPosition, MaximumPosition)
+		}
+	}
+	var (
+		names = map[string]bool{}
+		ids   = map[string]string{}
+	)
+	for _, j := range r.Joints {
+		if j.Name == "" {
+			return errors.New("joint name should not be empty")
+		}
+		if names[j.Name] {
+			return fmt.Errorf("joint %s is described twice", j.Name)
+		}
+		names[j.Name] = true
+		if j.Port == "" {
+			return fmt.Errorf("joint %s has no port", j.Name)
+		}
+		if j.ID > 31 {
+			return fmt.Errorf("joint %s id %d should be less than or equal to 31", j.Name, j.ID)
+		}
+		key := fmt.Sprintf("%s/%d", j.Port, j.ID)
+		if other, ok := ids[key]; ok {
+			return fmt.Errorf("joint %s and %s are both id %d on port %s", other, j.Name, j.ID, j.Port)
+		}
+		ids[key] = j.Name
+		if j.Direction != 1 && j.Direction != -1 {
+			return fmt.Errorf("joint %s direction should be 1 or -1, but actual %d", j.Name, j.Direction)
+		}
+		if j.Limits.Mode != "" && j.Limits.Mode != Reject && j.Limits.Mode != Clamp {
+			return fmt.Errorf("joint %s limit mode should be %s or %s, but actual %s", j.Name, Reject, Clamp, j.Limits.Mode)
+		}
+		servo, ok := r.Servo(j.Model)
+		if !ok {
+			return fmt.Errorf("joint %s model %q is not a known servo, declare it under servos", j.Name, j.Model)
+		}
+		if j.Limits.Min != 0 || j.Limits.Max != 0 {
+			if j.Limits.Min < servo.Min || j.Limits.Max > servo.Max || j.Limits.Min >= j.Limits.Max {
+				return fmt.Errorf("joint %s limits %d-%d should be inside %d-%d of %s", j.Name, j.Limits.Min, j.Limits.Max, servo.Min, servo.Max, servo.Model)
+			}
+		}
+		if j.SignalSpeed != "" {
+			var speed eeprom.SignalSpeed
+			if err := speed.UnmarshalText([]byte(j.SignalSpeed)); err != nil {
+				return fmt.Errorf("joint %s: %w", j.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Joint finds a joint by name
+func (r *Robot) Joint(name string) (Joint, bool) {
+	for _, j := range r.Joints {
+		if j.Name == name {
+			return j, true
+		}
+	}
+	return Joint{}, false
+}
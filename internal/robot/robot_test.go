@@ -0,0 +1,89 @@
+package robot
+
+import (
+	"strings"
+	"testing"
+)
+
+const twoJoints = `name: arm
+joints:
+- name: Shoulder
+  port: left
+  id: 1
+  model: KRS-2552RHV
+  direction: 1
+  zero-offset: 0
+- name: Elbow
+  port: left
+  id: 2
+  model: KRS-2552RHV
+  direction: -1
+  zero-offset: -120
+  limits:
+    min: 5000
+    max: 10000
+  signal-speed: High
+`
+
+func TestLoad(t *testing.T) {
+	r, err := Load([]byte(twoJoints))
+	if err != nil {
+		t.Fatal(err)
+	}
+	elbow, ok := r.Joint("Elbow")
+	if !ok {
+		t.Fatal("Elbow should be found")
+	}
+	if elbow.Direction != -1 || elbow.ZeroOffset != -120 || elbow.Limits != (Limits{Min: 5000, Max: 10000}) || elbow.SignalSpeed != "High" {
+		t.Errorf("Elbow is wrong, actual %+v", elbow)
+	}
+	data, err := r.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Load(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.Joints) != 2 || again.Joints[1] != elbow {
+		t.Errorf("Marshal and Load should round trip, actual %+v", again)
+	}
+}
+
+func TestServos(t *testing.T) {
+	for _, s := range KnownServos() {
+		if s.Min < MinimumPosition || s.Max > MaximumPosition || s.Min >= s.Max {
+			t.Errorf("%s range %d-%d should be inside %d-%d", s.Model, s.Min, s.Max, MinimumPosition, MaximumPosition)
+		}
+	}
+	declared := strings.Replace(twoJoints, "joints:", "servos:\n- {model: KRS-788HV, min: 4000, max: 11000}\njoints:", 1)
+	r, err := Load([]byte(strings.Replace(declared, "model: KRS-2552RHV", "model: KRS-788HV", 1)))
+	if err != nil {
+		t.Fatalf("a declared servo should be usable, %v", err)
+	}
+	if s, ok := r.Servo("KRS-788HV"); !ok || s.Min != 4000 {
+		t.Errorf("KRS-788HV should be declared, actual %+v", s)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := map[string]string{
+		"same name":       strings.Replace(twoJoints, "name: Elbow", "name: Shoulder", 1),
+		"same id":         strings.Replace(twoJoints, "id: 2", "id: 1", 1),
+		"id too large":    strings.Replace(twoJoints, "id: 2", "id: 32", 1),
+		"direction":       strings.Replace(twoJoints, "direction: -1", "direction: 0", 1),
+		"limits":          strings.Replace(twoJoints, "max: 10000", "max: 12000", 1),
+		"no port":         strings.Replace(twoJoints, "port: left\n  id: 2", "port: \"\"\n  id: 2", 1),
+		"unknown field":   strings.Replace(twoJoints, "direction: 1", "direction: 1\n  reverse: true", 1),
+		"signal speed":    strings.Replace(twoJoints, "signal-speed: High", "signal-speed: Fast", 1),
+		"unknown model":   strings.Replace(twoJoints, "model: KRS-2552RHV", "model: KRS-788HV", 1),
+		"servo range":     strings.Replace(twoJoints, "joints:", "servos:\n- {model: KRS-2552RHV, min: 6000, max: 9000}\njoints:", 1),
+		"bad servo":       strings.Replace(twoJoints, "joints:", "servos:\n- {model: KRS-788HV, min: 500, max: 2500}\njoints:", 1),
+		"no joint at all": "name: empty\n",
+	}
+	for name, data := range cases {
+		if _, err := Load([]byte(data)); err == nil {
+			t.Errorf("%s: Load should fail", name)
+		}
+	}
+}
@@ -2,7 +2,6 @@ package serial
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"kondocontrol/internal/convert"
 	"kondocontrol/internal/eeprom"
@@ -46,11 +45,26 @@ func WriteEEPROM(id uint8, sc SubCommand, data []byte, port io.ReadWriteCloser)
 
 // ReadEEPROM
 func ReadEEPROM(id uint8, sc SubCommand, port io.ReadWriteCloser) ([]byte, error) {
+	result, err := ReadRawEEPROM(id, sc, port)
+	if err != nil {
+		return nil, err
+	}
+	// Confirm that this data is normal EEPROM data
+	_, err = eeprom.Parse(result)
+	if err != nil {
+
+		return nil, errors.Wrap(err, "[ReadEEPROM]")
+	}
+	return result, nil
+}
+
+// ReadRawEEPROM reads like ReadEEPROM without checking the data,
+// so that a broken EEPROM can still be inspected
+func ReadRawEEPROM(id uint8, sc SubCommand, port io.ReadWriteCloser) ([]byte, error) {
 	var (
 		cmd uint8 = 0b10100000 + id
 	)
 	b := []byte{cmd, uint8(sc)}
-	fmt.Println(printHex(b))
 	result, err := writeAndRead(port, b)
 	if err != nil {
 		return nil, errors.Wrap(err, "[ReadEEPROM]")
@@ -58,13 +72,25 @@ func ReadEEPROM(id uint8, sc SubCommand, port io.ReadWriteCloser) ([]byte, error
 	if len(result) < 2 {
 		return nil, errors.New("The result length should not be smaller than 2")
 	}
-	// Confirm that this data is normal EEPROM data
-	_, err = eeprom.Parse(result[2:])
-	if err != nil {
+	return result[2:], nil
+}
 
-		return nil, errors.Wrap(err, "[ReadEEPROM]")
+// ReadParameter reads a one byte parameter, ScStretch, ScSpeed, ScCurrent or ScTemperature
+func ReadParameter(id uint8, sc SubCommand, port io.ReadWriteCloser) (uint8, error) {
+	if sc == ScEEPROM {
+		return 0, errors.New("[ReadParameter] EEPROM is not a one byte parameter, use ReadEEPROM")
 	}
-	return result[2:], nil
+	var (
+		cmd uint8 = 0b10100000 + id
+	)
+	result, err := writeAndRead(port, []byte{cmd, uint8(sc)})
+	if err != nil {
+		return 0, errors.Wrap(err, "[ReadParameter]")
+	}
+	if len(result) != 3 || result[1] != uint8(sc) {
+		return 0, errors.Errorf("[ReadParameter] reply % X should be the command, the subcommand and a value", result)
+	}
+	return result[2], nil
 }
 
 // SetPosition
@@ -123,11 +149,3 @@ func writeAndRead(port io.ReadWriteCloser, b []byte) ([]byte, error) {
 	}
 	return data[writeN:readN], nil
 }
-
-func printHex(bs []byte) string {
-	sum := ""
-	for _, b := range bs {
-		sum += fmt.Sprintf("%X", b) + " "
-	}
-	return sum
-}